@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/antihax/optional"
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"github.com/spf13/cobra"
+)
+
+const (
+	GranteeUser  = "user"
+	GranteeGroup = "group"
+
+	AccessOnFile       = "file"
+	AccessOnCollection = "collection"
+)
+
+var explainUserKey string
+
+// AccessExplanation is the result of access explain.
+type AccessExplanation struct {
+	File        string             `json:"file"`
+	User        string             `json:"user"`
+	CanRead     bool               `json:"canRead"`
+	Groups      []string           `json:"groups"`
+	Collections []CollectionAccess `json:"collections"`
+}
+
+// CollectionAccess tells whether a user can read a collection holding a
+// file, or above one that does, with the chain of collections down to the
+// file.
+type CollectionAccess struct {
+	Collection string   `json:"collection"`
+	Path       []string `json:"path"`
+	CanRead    bool     `json:"canRead"`
+}
+
+var accessCmd = &cobra.Command{
+	Use:   "access",
+	Short: "Access control commands for Hiarc",
+	Run:   nil,
+}
+
+var explainAccessCmd = &cobra.Command{
+	Use:   "explain [file key]",
+	Short: "Explain the access a user has to a file",
+	Long: `Show whether a user can read a file, the groups of the user, and which of
+the collections holding the file, and of the collections above those, the
+user can read, with the chain of collections each one reaches the file
+through. Access to a collection is inherited by what is in it, so these are
+the collections the user's access may come from.
+
+Everything is checked by asking Hiarc as the user. Hiarc has no endpoint to
+read grants or access levels, so the level the user has, and whether it was
+granted on the file, on a collection or to a group, can't be shown.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hiarcClient := ConfigureHiarcClient()
+		explanation, err := ExplainAccess(hiarcClient, args[0], explainUserKey)
+		if err != nil {
+			return err
+		}
+		return PrintResult(explanation)
+	},
+}
+
+// ExplainAccess asks Hiarc, as userKey, whether the user can read fileKey and
+// the collections it is in or below.
+func ExplainAccess(client *hiarc.APIClient, fileKey string, userKey string) (AccessExplanation, error) {
+	explanation := AccessExplanation{File: fileKey, User: userKey, Groups: []string{}, Collections: []CollectionAccess{}}
+
+	if _, r, err := client.UserApi.GetUser(context.Background(), userKey); err != nil {
+		return explanation, NewAPIError("UserApi.GetUser", r, err)
+	}
+	groups, r, err := client.UserApi.GetGroupsForUser(context.Background(), userKey, &hiarc.GetGroupsForUserOpts{})
+	if err != nil {
+		return explanation, NewAPIError("UserApi.GetGroupsForUser", r, err)
+	}
+	for _, g := range groups {
+		explanation.Groups = append(explanation.Groups, g.Key)
+	}
+	sort.Strings(explanation.Groups)
+
+	if _, r, err := client.FileApi.GetFile(context.Background(), fileKey, &hiarc.GetFileOpts{}); err != nil {
+		return explanation, NewAPIError("FileApi.GetFile", r, err)
+	}
+	collections, r, err := client.FileApi.GetCollectionsForFile(context.Background(), fileKey, &hiarc.GetCollectionsForFileOpts{})
+	if err != nil {
+		return explanation, NewAPIError("FileApi.GetCollectionsForFile", r, err)
+	}
+	if explanation.CanRead, err = canReadFile(client, userKey, fileKey); err != nil {
+		return explanation, err
+	}
+	if len(collections) == 0 {
+		return explanation, nil
+	}
+
+	tree, err := loadAccessTree(client, "")
+	if err != nil {
+		return explanation, err
+	}
+	var keys []string
+	for _, c := range collections {
+		keys = append(keys, c.Key)
+	}
+	for _, a := range tree.above(keys, "file "+fileKey) {
+		if a.CanRead, err = canReadCollection(client, userKey, a.Collection); err != nil {
+			return explanation, err
+		}
+		explanation.Collections = append(explanation.Collections, a)
+	}
+	return explanation, nil
+}
+
+// canReadFile asks Hiarc whether userKey can read the file with key.
+func canReadFile(client *hiarc.APIClient, userKey string, key string) (bool, error) {
+	opts := hiarc.GetFileOpts{XHiarcUserKey: optional.NewString(userKey)}
+	_, r, err := client.FileApi.GetFile(context.Background(), key, &opts)
+	return accessAllowed("FileApi.GetFile", r, err)
+}
+
+// canReadCollection asks Hiarc whether userKey can read the collection with
+// key.
+func canReadCollection(client *hiarc.APIClient, userKey string, key string) (bool, error) {
+	opts := hiarc.GetCollectionOpts{XHiarcUserKey: optional.NewString(userKey)}
+	_, r, err := client.CollectionApi.GetCollection(context.Background(), key, &opts)
+	return accessAllowed("CollectionApi.GetCollection", r, err)
+}
+
+// accessAllowed tells a request refused for lack of access apart from other
+// failures.
+func accessAllowed(operation string, r *http.Response, err error) (bool, error) {
+	switch {
+	case err == nil:
+		return true, nil
+	case r != nil && (r.StatusCode == http.StatusForbidden || r.StatusCode == http.StatusUnauthorized || r.StatusCode == http.StatusNotFound):
+		return false, nil
+	}
+	return false, NewAPIError(operation, r, err)
+}
+
+// accessTree holds the collection hierarchy grants are inherited through.
+type accessTree struct {
+	parents     map[string][]string
+	collections map[string]hiarc.Collection
+}
+
+// loadAccessTree fetches every collection asUser can see and works out their
+// parents. Hiarc only lists children, so every collection is asked.
+func loadAccessTree(client *hiarc.APIClient, asUser string) (*accessTree, error) {
+	opts := hiarc.GetAllCollectionsOpts{}
+	if asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(asUser)
+	}
+	collections, r, err := client.CollectionApi.GetAllCollections(context.Background(), &opts)
+	if err != nil {
+		return nil, NewAPIError("CollectionApi.GetAllCollections", r, err)
+	}
+	t := &accessTree{parents: map[string][]string{}, collections: map[string]hiarc.Collection{}}
+	for _, c := range collections {
+		t.collections[c.Key] = c
+		childOpts := hiarc.GetCollectionChildrenOpts{}
+		if asUser != "" {
+			childOpts.XHiarcUserKey = optional.NewString(asUser)
+		}
+		children, r, err := client.CollectionApi.GetCollectionChildren(context.Background(), c.Key, &childOpts)
+		if err != nil {
+			return nil, NewAPIError("CollectionApi.GetCollectionChildren", r, err)
+		}
+		for _, child := range children {
+			t.parents[child.Key] = append(t.parents[child.Key], c.Key)
+		}
+	}
+	return t, nil
+}
+
+// above returns the collections with keys and the collections above them, each
+// once, nearest first, with the chain from the collection down to below.
+func (t *accessTree) above(keys []string, below string) []CollectionAccess {
+	var found []CollectionAccess
+	seen := map[string]bool{}
+	queue := []CollectionAccess{}
+	for _, k := range keys {
+		queue = append(queue, CollectionAccess{Collection: k, Path: []string{"collection " + k, below}})
+	}
+	for len(queue) > 0 {
+		a := queue[0]
+		queue = queue[1:]
+		if seen[a.Collection] {
+			continue
+		}
+		seen[a.Collection] = true
+		found = append(found, a)
+		for _, p := range t.parents[a.Collection] {
+			queue = append(queue, CollectionAccess{Collection: p, Path: append([]string{"collection " + p}, a.Path...)})
+		}
+	}
+	return found
+}
+
+// parseAccessLevel validates an access level given in any case.
+func parseAccessLevel(s string) (hiarc.AccessLevel, error) {
+	accessLevel := strings.ToUpper(s)
+	if !IsValidAccessLevel(accessLevel) {
+		return "", NewValidationError("%s is not a valid access level. Choose from the following: %s, %s, %s, or %s", accessLevel, string(hiarc.CO_OWNER), string(hiarc.READ_WRITE), string(hiarc.READ_ONLY), string(hiarc.UPLOAD_ONLY))
+	}
+	return GetAccessLevelFromString(accessLevel)
+}
+
+// grantAccess grants a user or group access to a file or collection.
+func grantAccess(client *hiarc.APIClient, asUser string, resource string, key string, kind string, grantee string, al hiarc.AccessLevel) error {
+	var r *http.Response
+	var err error
+	operation := ""
+	switch {
+	case resource == AccessOnFile && kind == GranteeGroup:
+		opts := hiarc.AddGroupToFileOpts{}
+		if asUser != "" {
+			opts.XHiarcUserKey = optional.NewString(asUser)
+		}
+		operation = "FileApi.AddGroupToFile"
+		_, r, err = client.FileApi.AddGroupToFile(context.Background(), key, hiarc.AddGroupToFileRequest{GroupKey: grantee, AccessLevel: al}, &opts)
+	case resource == AccessOnFile:
+		opts := hiarc.AddUserToFileOpts{}
+		if asUser != "" {
+			opts.XHiarcUserKey = optional.NewString(asUser)
+		}
+		operation = "FileApi.AddUserToFile"
+		_, r, err = client.FileApi.AddUserToFile(context.Background(), key, hiarc.AddUserToFileRequest{UserKey: grantee, AccessLevel: al}, &opts)
+	case kind == GranteeGroup:
+		opts := hiarc.AddGroupToCollectionOpts{}
+		if asUser != "" {
+			opts.XHiarcUserKey = optional.NewString(asUser)
+		}
+		operation = "CollectionApi.AddGroupToCollection"
+		_, r, err = client.CollectionApi.AddGroupToCollection(context.Background(), key, hiarc.AddGroupToCollectionRequest{GroupKey: grantee, AccessLevel: al}, &opts)
+	default:
+		opts := hiarc.AddUserToCollectionOpts{}
+		if asUser != "" {
+			opts.XHiarcUserKey = optional.NewString(asUser)
+		}
+		operation = "CollectionApi.AddUserToCollection"
+		_, r, err = client.CollectionApi.AddUserToCollection(context.Background(), key, hiarc.AddUserToCollectionRequest{UserKey: grantee, AccessLevel: al}, &opts)
+	}
+	if err != nil {
+		return NewAPIError(operation, r, err)
+	}
+	return nil
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	rootCmd.AddCommand(accessCmd)
+	accessCmd.AddCommand(explainAccessCmd)
+
+	explainAccessCmd.Flags().StringVar(&explainUserKey, "user", "", "Key of the user to explain the access of")
+	explainAccessCmd.MarkFlagRequired("user")
+}
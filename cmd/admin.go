@@ -25,7 +25,6 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -39,30 +38,41 @@ var adminCmd = &cobra.Command{
 var initDBCmd = &cobra.Command{
 	Use:   "init-db",
 	Short: "Run init scripts on the graph database",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 
 		_, r, err := hiarcClient.AdminApi.InitDB(context.Background())
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `AdminApi.InitDB``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("AdminApi.InitDB", r, err)
 		}
 		log.Println("Database initialized")
+		return nil
 	},
 }
 
+var resetExportTo string
+
 var resetDBCmd = &cobra.Command{
 	Use:   "reset-db",
 	Short: "Run reset scripts on the graph database",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := ConfirmDestructive("reset the database"); err != nil {
+			return err
+		}
 		hiarcClient := ConfigureHiarcClient()
+		if resetExportTo != "" {
+			if _, err := ExportBackup(hiarcClient, resetExportTo, exportContent, exportLegalHolds); err != nil {
+				return err
+			}
+			log.Println(fmt.Sprintf("Exported to %s", resetExportTo))
+		}
 
 		_, r, err := hiarcClient.AdminApi.ResetDB(context.Background())
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `AdminApi.InitDB``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("AdminApi.ResetDB", r, err)
 		}
 		log.Println("Database reset")
+		return nil
 	},
 }
 
@@ -70,4 +80,9 @@ func init() {
 	rootCmd.AddCommand(adminCmd)
 	adminCmd.AddCommand(initDBCmd)
 	adminCmd.AddCommand(resetDBCmd)
+
+	addConfirmFlag(resetDBCmd)
+	resetDBCmd.Flags().StringVar(&resetExportTo, "export-to", "", "Export to this directory before resetting, restore with hiarc import --from")
+	resetDBCmd.Flags().BoolVar(&exportContent, "export-content", false, "Include the latest content of every file in the export")
+	resetDBCmd.Flags().StringArrayVar(&exportLegalHolds, "export-legal-hold", []string{}, "Key of a legal hold to export, can be repeated")
 }
@@ -0,0 +1,493 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// Plan actions.
+const (
+	PlanCreateUser       = "create-user"
+	PlanUpdateUser       = "update-user"
+	PlanCreateGroup      = "create-group"
+	PlanUpdateGroup      = "update-group"
+	PlanAddMember        = "add-member"
+	PlanCreateCollection = "create-collection"
+	PlanUpdateCollection = "update-collection"
+	PlanAddChild         = "add-child"
+	PlanGrant            = "grant"
+)
+
+// Plan action statuses.
+const (
+	PlanStatusPlanned = "planned"
+	PlanStatusDone    = "done"
+	PlanStatusFailed  = "failed"
+)
+
+const applyLong = `A policy file is a YAML document declaring users, groups and their
+members, collections, their parents and the grants on them, and grants on
+existing files:
+
+  users:
+    - key: alice
+      name: Alice
+  groups:
+    - key: sales
+      name: Sales
+      members: [alice]
+  collections:
+    - key: sales-docs
+      name: Sales documents
+      parent: docs
+      grants:
+        - group: sales
+          access: READ_WRITE
+        - user: alice
+          access: CO_OWNER
+  files:
+    - key: price-list
+      grants:
+        - group: sales
+          access: READ_ONLY
+
+Names, descriptions and metadata are only compared when declared, and
+metadata properties that aren't declared are kept.
+
+Hiarc has no endpoint to read grants, so grants can't be compared: every
+declared grant is planned, and granted again, on each run, and diff doesn't
+show the grants Hiarc actually has. Pruning isn't implemented either, as
+Hiarc has no endpoints to revoke grants or remove members, so grants that
+aren't declared are left in place and members are only ever added.`
+
+var policyPath string
+
+// Policy is a permissions-as-code document.
+type Policy struct {
+	Users       []PolicyEntity     `yaml:"users"`
+	Groups      []PolicyGroup      `yaml:"groups"`
+	Collections []PolicyCollection `yaml:"collections"`
+	Files       []PolicyFile       `yaml:"files"`
+}
+
+type PolicyEntity struct {
+	Key         string                 `yaml:"key"`
+	Name        string                 `yaml:"name"`
+	Description string                 `yaml:"description"`
+	Metadata    map[string]interface{} `yaml:"metadata"`
+}
+
+type PolicyGroup struct {
+	PolicyEntity `yaml:",inline"`
+	Members      []string `yaml:"members"`
+}
+
+type PolicyCollection struct {
+	PolicyEntity `yaml:",inline"`
+	Parent       string        `yaml:"parent"`
+	Grants       []PolicyGrant `yaml:"grants"`
+}
+
+type PolicyFile struct {
+	Key    string        `yaml:"key"`
+	Grants []PolicyGrant `yaml:"grants"`
+}
+
+// PolicyGrant grants access to either a user or a group.
+type PolicyGrant struct {
+	User   string `yaml:"user"`
+	Group  string `yaml:"group"`
+	Access string `yaml:"access"`
+}
+
+// PlanAction is one change needed to bring Hiarc in line with a policy.
+type PlanAction struct {
+	Action string `json:"action"`
+	Key    string `json:"key"`
+	Detail string `json:"detail"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	apply func() error
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the changes apply would make for a policy file",
+	Long:  "Compare a policy file with Hiarc and print the planned changes.\n\n" + applyLong,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy, err := LoadPolicy(policyPath)
+		if err != nil {
+			return err
+		}
+		actions, err := PlanPolicy(ConfigureHiarcClient(), policy)
+		if err != nil {
+			return err
+		}
+		if len(actions) == 0 {
+			log.Println("No changes, Hiarc matches the policy")
+		}
+		return PrintResult(actions)
+	},
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Bring users, groups, collections and grants in line with a policy file",
+	Long:  "Compare a policy file with Hiarc and make only the changes needed.\n\n" + applyLong,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy, err := LoadPolicy(policyPath)
+		if err != nil {
+			return err
+		}
+		actions, err := PlanPolicy(ConfigureHiarcClient(), policy)
+		if err != nil {
+			return err
+		}
+
+		failed := 0
+		for i := range actions {
+			a := &actions[i]
+			if a.apply == nil {
+				continue
+			}
+			if err := a.apply(); err != nil {
+				a.Status = PlanStatusFailed
+				a.Error = err.Error()
+				failed++
+			} else {
+				a.Status = PlanStatusDone
+			}
+			log.Println(fmt.Sprintf("%s %s %s: %s", a.Action, a.Key, a.Detail, a.Status))
+		}
+		if err := PrintResult(actions); err != nil {
+			return err
+		}
+		if failed > 0 {
+			return NewPartialFailure(failed, len(actions), "policy changes failed")
+		}
+		return nil
+	},
+}
+
+// LoadPolicy reads and validates a policy file, or standard input for "-".
+func LoadPolicy(p string) (Policy, error) {
+	var policy Policy
+	var data []byte
+	var err error
+	if p == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(p)
+	}
+	if err != nil {
+		return policy, err
+	}
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return policy, NewValidationError("Invalid policy file %s: %s", p, err.Error())
+	}
+
+	var grants []PolicyGrant
+	for _, u := range policy.Users {
+		if u.Key == "" {
+			return policy, NewValidationError("Invalid policy file %s: every user needs a key", p)
+		}
+	}
+	for _, g := range policy.Groups {
+		if g.Key == "" {
+			return policy, NewValidationError("Invalid policy file %s: every group needs a key", p)
+		}
+	}
+	for _, c := range policy.Collections {
+		if c.Key == "" {
+			return policy, NewValidationError("Invalid policy file %s: every collection needs a key", p)
+		}
+		grants = append(grants, c.Grants...)
+	}
+	for _, f := range policy.Files {
+		if f.Key == "" {
+			return policy, NewValidationError("Invalid policy file %s: every file needs a key", p)
+		}
+		grants = append(grants, f.Grants...)
+	}
+	for _, g := range grants {
+		if (g.User == "") == (g.Group == "") {
+			return policy, NewValidationError("Invalid policy file %s: a grant needs either a user or a group", p)
+		}
+		if _, err := parseAccessLevel(g.Access); err != nil {
+			return policy, err
+		}
+	}
+	return policy, nil
+}
+
+// PlanPolicy compares policy with Hiarc and returns the changes to make, in
+// the order they can be made in.
+func PlanPolicy(client *hiarc.APIClient, policy Policy) ([]PlanAction, error) {
+	pl := &policyPlanner{client: client, userGroups: map[string][]string{}}
+	if err := pl.users(policy.Users); err != nil {
+		return nil, err
+	}
+	if err := pl.groups(policy.Groups); err != nil {
+		return nil, err
+	}
+	if err := pl.collections(policy.Collections); err != nil {
+		return nil, err
+	}
+	if err := pl.files(policy.Files); err != nil {
+		return nil, err
+	}
+	actions := []PlanAction{}
+	for _, step := range [][]PlanAction{pl.entities, pl.members, pl.children, pl.grants} {
+		actions = append(actions, step...)
+	}
+	return actions, nil
+}
+
+type policyPlanner struct {
+	client     *hiarc.APIClient
+	userGroups map[string][]string
+
+	// Changes are kept per step so collections exist before children are
+	// added and grants are made.
+	entities []PlanAction
+	members  []PlanAction
+	children []PlanAction
+	grants   []PlanAction
+}
+
+func planned(action string, key string, detail string, apply func() error) PlanAction {
+	return PlanAction{Action: action, Key: key, Detail: detail, Status: PlanStatusPlanned, apply: apply}
+}
+
+// entityChanges lists the declared fields that differ from the live ones and
+// returns the metadata to update, with undeclared properties kept.
+func entityChanges(e PolicyEntity, name string, description string, metadata map[string]interface{}) ([]string, map[string]interface{}) {
+	var changes []string
+	if e.Name != "" && e.Name != name {
+		changes = append(changes, "name")
+	}
+	if e.Description != "" && e.Description != description {
+		changes = append(changes, "description")
+	}
+	md := map[string]interface{}{}
+	for k, v := range metadata {
+		md[k] = v
+	}
+	var keys []string
+	for k := range e.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := metadata[k]; !ok || !valuesEqual(v, e.Metadata[k]) {
+			changes = append(changes, "metadata."+k)
+			md[k] = e.Metadata[k]
+		}
+	}
+	return changes, md
+}
+
+func (pl *policyPlanner) users(users []PolicyEntity) error {
+	for _, u := range users {
+		u := u
+		live, r, err := pl.client.UserApi.GetUser(context.Background(), u.Key)
+		if err != nil {
+			if !IsNotFound(NewAPIError("UserApi.GetUser", r, err)) {
+				return NewAPIError("UserApi.GetUser", r, err)
+			}
+			pl.userGroups[u.Key] = []string{}
+			pl.entities = append(pl.entities, planned(PlanCreateUser, u.Key, "", func() error {
+				req := hiarc.CreateUserRequest{Key: u.Key, Name: u.Name, Description: u.Description, Metadata: u.Metadata}
+				_, r, err := pl.client.UserApi.CreateUser(context.Background(), req)
+				if err != nil {
+					return NewAPIError("UserApi.CreateUser", r, err)
+				}
+				return nil
+			}))
+			continue
+		}
+		changes, md := entityChanges(u, live.Name, live.Description, live.Metadata)
+		if len(changes) > 0 {
+			pl.entities = append(pl.entities, planned(PlanUpdateUser, u.Key, strings.Join(changes, ", "), func() error {
+				req := hiarc.UpdateUserRequest{Name: u.Name, Description: u.Description, Metadata: md}
+				_, r, err := pl.client.UserApi.UpdateUser(context.Background(), u.Key, req)
+				if err != nil {
+					return NewAPIError("UserApi.UpdateUser", r, err)
+				}
+				return nil
+			}))
+		}
+	}
+	return nil
+}
+
+func (pl *policyPlanner) groups(groups []PolicyGroup) error {
+	for _, g := range groups {
+		g := g
+		live, r, err := pl.client.GroupApi.GetGroup(context.Background(), g.Key)
+		if err != nil {
+			if !IsNotFound(NewAPIError("GroupApi.GetGroup", r, err)) {
+				return NewAPIError("GroupApi.GetGroup", r, err)
+			}
+			pl.entities = append(pl.entities, planned(PlanCreateGroup, g.Key, "", func() error {
+				req := hiarc.CreateGroupRequest{Key: g.Key, Name: g.Name, Description: g.Description, Metadata: g.Metadata}
+				_, r, err := pl.client.GroupApi.CreateGroup(context.Background(), req)
+				if err != nil {
+					return NewAPIError("GroupApi.CreateGroup", r, err)
+				}
+				return nil
+			}))
+		} else if changes, md := entityChanges(g.PolicyEntity, live.Name, live.Description, live.Metadata); len(changes) > 0 {
+			pl.entities = append(pl.entities, planned(PlanUpdateGroup, g.Key, strings.Join(changes, ", "), func() error {
+				req := hiarc.UpdateGroupRequest{Name: g.Name, Description: g.Description, Metadata: md}
+				_, r, err := pl.client.GroupApi.UpdateGroup(context.Background(), g.Key, req)
+				if err != nil {
+					return NewAPIError("GroupApi.UpdateGroup", r, err)
+				}
+				return nil
+			}))
+		}
+
+		for _, m := range g.Members {
+			m := m
+			groups, err := pl.groupsOf(m)
+			if err != nil {
+				return err
+			}
+			if containsString(groups, g.Key) {
+				continue
+			}
+			pl.members = append(pl.members, planned(PlanAddMember, g.Key, "user "+m, func() error {
+				_, r, err := pl.client.GroupApi.AddUserToGroup(context.Background(), g.Key, m)
+				if err != nil {
+					return NewAPIError("GroupApi.AddUserToGroup", r, err)
+				}
+				return nil
+			}))
+		}
+	}
+	return nil
+}
+
+// groupsOf returns the keys of the groups a user is in, none for users that
+// don't exist yet.
+func (pl *policyPlanner) groupsOf(userKey string) ([]string, error) {
+	if groups, ok := pl.userGroups[userKey]; ok {
+		return groups, nil
+	}
+	groups, r, err := pl.client.UserApi.GetGroupsForUser(context.Background(), userKey, &hiarc.GetGroupsForUserOpts{})
+	if err != nil {
+		if IsNotFound(NewAPIError("UserApi.GetGroupsForUser", r, err)) {
+			return nil, nil
+		}
+		return nil, NewAPIError("UserApi.GetGroupsForUser", r, err)
+	}
+	keys := []string{}
+	for _, g := range groups {
+		keys = append(keys, g.Key)
+	}
+	pl.userGroups[userKey] = keys
+	return keys, nil
+}
+
+func (pl *policyPlanner) collections(collections []PolicyCollection) error {
+	children := map[string][]string{}
+	for _, c := range collections {
+		c := c
+		live, r, err := pl.client.CollectionApi.GetCollection(context.Background(), c.Key, &hiarc.GetCollectionOpts{})
+		if err != nil {
+			if !IsNotFound(NewAPIError("CollectionApi.GetCollection", r, err)) {
+				return NewAPIError("CollectionApi.GetCollection", r, err)
+			}
+			pl.entities = append(pl.entities, planned(PlanCreateCollection, c.Key, "", func() error {
+				req := hiarc.CreateCollectionRequest{Key: c.Key, Name: c.Name, Description: c.Description, Metadata: c.Metadata}
+				_, r, err := pl.client.CollectionApi.CreateCollection(context.Background(), req, &hiarc.CreateCollectionOpts{})
+				if err != nil {
+					return NewAPIError("CollectionApi.CreateCollection", r, err)
+				}
+				return nil
+			}))
+		} else if changes, md := entityChanges(c.PolicyEntity, live.Name, live.Description, live.Metadata); len(changes) > 0 {
+			pl.entities = append(pl.entities, planned(PlanUpdateCollection, c.Key, strings.Join(changes, ", "), func() error {
+				req := hiarc.UpdateCollectionRequest{Name: c.Name, Description: c.Description, Metadata: md}
+				_, r, err := pl.client.CollectionApi.UpdateCollection(context.Background(), c.Key, req, &hiarc.UpdateCollectionOpts{})
+				if err != nil {
+					return NewAPIError("CollectionApi.UpdateCollection", r, err)
+				}
+				return nil
+			}))
+		}
+
+		if c.Parent != "" {
+			if _, ok := children[c.Parent]; !ok {
+				children[c.Parent] = []string{}
+				kids, r, err := pl.client.CollectionApi.GetCollectionChildren(context.Background(), c.Parent, &hiarc.GetCollectionChildrenOpts{})
+				if err != nil && !IsNotFound(NewAPIError("CollectionApi.GetCollectionChildren", r, err)) {
+					return NewAPIError("CollectionApi.GetCollectionChildren", r, err)
+				}
+				for _, k := range kids {
+					children[c.Parent] = append(children[c.Parent], k.Key)
+				}
+			}
+			if !containsString(children[c.Parent], c.Key) {
+				pl.children = append(pl.children, planned(PlanAddChild, c.Parent, "collection "+c.Key, func() error {
+					_, r, err := pl.client.CollectionApi.AddChildToCollection(context.Background(), c.Parent, c.Key, &hiarc.AddChildToCollectionOpts{})
+					if err != nil {
+						return NewAPIError("CollectionApi.AddChildToCollection", r, err)
+					}
+					return nil
+				}))
+			}
+		}
+
+		pl.planGrants(AccessOnCollection, c.Key, c.Grants)
+	}
+	return nil
+}
+
+func (pl *policyPlanner) files(files []PolicyFile) error {
+	for _, f := range files {
+		if _, r, err := pl.client.FileApi.GetFile(context.Background(), f.Key, &hiarc.GetFileOpts{}); err != nil {
+			return NewAPIError("FileApi.GetFile", r, err)
+		}
+		pl.planGrants(AccessOnFile, f.Key, f.Grants)
+	}
+	return nil
+}
+
+// planGrants plans the declared grants on a file or collection. Hiarc can't
+// list grants, so they are all planned.
+func (pl *policyPlanner) planGrants(resource string, key string, grants []PolicyGrant) {
+	for _, g := range grants {
+		kind, grantee := GranteeUser, g.User
+		if g.Group != "" {
+			kind, grantee = GranteeGroup, g.Group
+		}
+		al, _ := parseAccessLevel(g.Access)
+		pl.grants = append(pl.grants, planned(PlanGrant, resource+" "+key, fmt.Sprintf("%s %s %s", kind, grantee, al), func() error {
+			return grantAccess(pl.client, "", resource, key, kind, grantee, al)
+		}))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(diffCmd)
+
+	for _, c := range []*cobra.Command{applyCmd, diffCmd} {
+		c.Flags().StringVarP(&policyPath, "filename", "f", "", "Policy file, or - to read standard input")
+		c.MarkFlagRequired("filename")
+	}
+}
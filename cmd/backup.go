@@ -0,0 +1,549 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"github.com/spf13/cobra"
+)
+
+// BackupFormatVersion is written to every export. Restoring refuses exports
+// with a newer format than it knows.
+const BackupFormatVersion = 1
+
+const backupManifestName = "manifest.json"
+
+// Files of an export, one JSON document per line.
+const (
+	backupClassifications   = "classifications.jsonl"
+	backupRetentionPolicies = "retention-policies.jsonl"
+	backupLegalHolds        = "legal-holds.jsonl"
+	backupUsers             = "users.jsonl"
+	backupGroups            = "groups.jsonl"
+	backupMemberships       = "memberships.jsonl"
+	backupCollections       = "collections.jsonl"
+	backupFiles             = "files.jsonl"
+	backupContentDir        = "content"
+)
+
+// backupOmitted lists what an export can't contain because Hiarc has no API
+// to read it back.
+var backupOmitted = []string{
+	"access grants of users and groups on files and collections",
+	"classifications applied to files",
+	"legal holds applied to files",
+	"files that aren't in any collection",
+	"legal holds not named with --legal-hold",
+}
+
+var (
+	exportOut        string
+	exportContent    bool
+	exportLegalHolds []string
+	importFrom       string
+)
+
+// BackupManifest describes an export.
+type BackupManifest struct {
+	FormatVersion int            `json:"formatVersion"`
+	ExportedAt    time.Time      `json:"exportedAt"`
+	Source        string         `json:"source"`
+	Content       bool           `json:"content"`
+	Counts        map[string]int `json:"counts"`
+	Omitted       []string       `json:"omitted"`
+}
+
+type BackupMembership struct {
+	GroupKey string `json:"groupKey"`
+	UserKey  string `json:"userKey"`
+}
+
+// BackupCollection is a collection with the keys of its children and files.
+type BackupCollection struct {
+	hiarc.Collection
+	Children []string `json:"children,omitempty"`
+	Files    []string `json:"files,omitempty"`
+}
+
+// BackupFile is a file with its versions and retention policies, and the
+// path of its latest content inside the export when it was included.
+type BackupFile struct {
+	hiarc.File
+	Versions          []hiarc.FileVersion `json:"versions,omitempty"`
+	RetentionPolicies []string            `json:"retentionPolicies,omitempty"`
+	ContentPath       string              `json:"contentPath,omitempty"`
+}
+
+// RestoreResult is the outcome of restoring one item of an export.
+type RestoreResult struct {
+	Type   string `json:"type"`
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export users, groups, collections, files and policies to a directory",
+	Long: `Export a Hiarc instance to a directory that can be restored with
+hiarc import --from. The directory holds a manifest.json with the format
+version and one JSON lines file per kind of resource. With --content the
+latest version of every file is downloaded as well, otherwise files are
+restored by attaching to the storage they are in.
+
+Hiarc has no API to list everything, so access grants, classifications and
+legal holds applied to files, and files outside of collections are not
+exported. Legal holds can only be exported by naming them with --legal-hold.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifest, err := ExportBackup(ConfigureHiarcClient(), exportOut, exportContent, exportLegalHolds)
+		if err != nil {
+			return err
+		}
+		return PrintResult(manifest)
+	},
+}
+
+// ExportBackup exports everything Hiarc can list to dir, together with the
+// legal holds named in legalHolds, and writes the manifest last.
+func ExportBackup(client *hiarc.APIClient, dir string, content bool, legalHolds []string) (BackupManifest, error) {
+	var manifest BackupManifest
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return manifest, err
+	}
+	if content {
+		if err := os.MkdirAll(filepath.Join(dir, backupContentDir), os.ModePerm); err != nil {
+			return manifest, err
+		}
+	}
+	e := &exporter{client: client, dir: dir, content: content, legalHoldKeys: legalHolds, counts: map[string]int{}}
+	for _, step := range []func() error{e.classifications, e.retentionPolicies, e.legalHolds, e.usersAndGroups, e.collectionsAndFiles} {
+		if err := step(); err != nil {
+			return manifest, err
+		}
+	}
+
+	manifest = BackupManifest{
+		FormatVersion: BackupFormatVersion,
+		ExportedAt:    time.Now().UTC(),
+		Source:        client.GetConfig().BasePath,
+		Content:       content,
+		Counts:        e.counts,
+		Omitted:       backupOmitted,
+	}
+	jsonData, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return manifest, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, backupManifestName), jsonData, 0644); err != nil {
+		return manifest, err
+	}
+	return manifest, nil
+}
+
+type exporter struct {
+	client        *hiarc.APIClient
+	dir           string
+	content       bool
+	legalHoldKeys []string
+	counts        map[string]int
+}
+
+// write stores items, a slice, as JSON lines.
+func (e *exporter) write(name string, items interface{}) error {
+	f, err := os.Create(filepath.Join(e.dir, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	list := toItems(items)
+	for _, item := range list {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	e.counts[name] = len(list)
+	log.Println(fmt.Sprintf("Exported %d items to %s", len(list), name))
+	return w.Flush()
+}
+
+func (e *exporter) classifications() error {
+	cs, r, err := e.client.ClassificationApi.GetAllClassifications(context.Background(), &hiarc.GetAllClassificationsOpts{})
+	if err != nil {
+		return NewAPIError("ClassificationApi.GetAllClassifications", r, err)
+	}
+	return e.write(backupClassifications, cs)
+}
+
+func (e *exporter) retentionPolicies() error {
+	rps, r, err := e.client.RetentionPolicyApi.GetAllRetentionPolicies(context.Background())
+	if err != nil {
+		return NewAPIError("RetentionPolicyApi.GetAllRetentionPolicies", r, err)
+	}
+	return e.write(backupRetentionPolicies, rps)
+}
+
+func (e *exporter) legalHolds() error {
+	lhs := []hiarc.LegalHold{}
+	for _, key := range e.legalHoldKeys {
+		lh, r, err := e.client.LegalHoldApi.GetLegalHold(context.Background(), key)
+		if err != nil {
+			return NewAPIError("LegalHoldApi.GetLegalHold", r, err)
+		}
+		lhs = append(lhs, lh)
+	}
+	return e.write(backupLegalHolds, lhs)
+}
+
+func (e *exporter) usersAndGroups() error {
+	users, r, err := e.client.UserApi.GetAllUsers(context.Background())
+	if err != nil {
+		return NewAPIError("UserApi.GetAllUsers", r, err)
+	}
+	if err := e.write(backupUsers, users); err != nil {
+		return err
+	}
+	groups, r, err := e.client.GroupApi.GetAllGroups(context.Background())
+	if err != nil {
+		return NewAPIError("GroupApi.GetAllGroups", r, err)
+	}
+	if err := e.write(backupGroups, groups); err != nil {
+		return err
+	}
+
+	memberships := []BackupMembership{}
+	for _, u := range users {
+		gs, r, err := e.client.UserApi.GetGroupsForUser(context.Background(), u.Key, &hiarc.GetGroupsForUserOpts{})
+		if err != nil {
+			return NewAPIError("UserApi.GetGroupsForUser", r, err)
+		}
+		for _, g := range gs {
+			memberships = append(memberships, BackupMembership{GroupKey: g.Key, UserKey: u.Key})
+		}
+	}
+	return e.write(backupMemberships, memberships)
+}
+
+func (e *exporter) collectionsAndFiles() error {
+	collections, r, err := e.client.CollectionApi.GetAllCollections(context.Background(), &hiarc.GetAllCollectionsOpts{})
+	if err != nil {
+		return NewAPIError("CollectionApi.GetAllCollections", r, err)
+	}
+
+	backups := []BackupCollection{}
+	files := map[string]hiarc.File{}
+	for _, c := range collections {
+		bc := BackupCollection{Collection: c}
+		children, r, err := e.client.CollectionApi.GetCollectionChildren(context.Background(), c.Key, &hiarc.GetCollectionChildrenOpts{})
+		if err != nil {
+			return NewAPIError("CollectionApi.GetCollectionChildren", r, err)
+		}
+		for _, child := range children {
+			bc.Children = append(bc.Children, child.Key)
+		}
+		fs, r, err := e.client.CollectionApi.GetCollectionFiles(context.Background(), c.Key, &hiarc.GetCollectionFilesOpts{})
+		if err != nil {
+			return NewAPIError("CollectionApi.GetCollectionFiles", r, err)
+		}
+		for _, f := range fs {
+			bc.Files = append(bc.Files, f.Key)
+			files[f.Key] = f
+		}
+		backups = append(backups, bc)
+	}
+	if err := e.write(backupCollections, backups); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(files))
+	for k := range files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	exported := []BackupFile{}
+	for i, k := range keys {
+		bf := BackupFile{File: files[k]}
+		versions, r, err := e.client.FileApi.GetVersions(context.Background(), k, &hiarc.GetVersionsOpts{})
+		if err != nil {
+			return NewAPIError("FileApi.GetVersions", r, err)
+		}
+		bf.Versions = versions
+		rps, r, err := e.client.FileApi.GetRetentionPolicies(context.Background(), k, &hiarc.GetRetentionPoliciesOpts{})
+		if err != nil {
+			return NewAPIError("FileApi.GetRetentionPolicies", r, err)
+		}
+		for _, rp := range rps {
+			bf.RetentionPolicies = append(bf.RetentionPolicies, rp.RetentionPolicy.Key)
+		}
+		if e.content {
+			bf.ContentPath = filepath.ToSlash(filepath.Join(backupContentDir, fmt.Sprintf("%06d", i+1)))
+			if err := DownloadFileToPath(e.client, k, "", filepath.Join(e.dir, bf.ContentPath)); err != nil {
+				return err
+			}
+		}
+		exported = append(exported, bf)
+	}
+	return e.write(backupFiles, exported)
+}
+
+// restorer replays an export in dependency order. Everything that already
+// exists is skipped, so a restore can be run again after a failure.
+type restorer struct {
+	client  *hiarc.APIClient
+	dir     string
+	results []RestoreResult
+}
+
+// RestoreBackup restores the export in dir.
+func RestoreBackup(hiarcClient *hiarc.APIClient, dir string) ([]RestoreResult, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, backupManifestName))
+	if err != nil {
+		return nil, err
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, NewValidationError("Invalid export manifest: %v", err)
+	}
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > BackupFormatVersion {
+		return nil, NewValidationError("The export in %s has format version %d, this version of the CLI can restore version %d", dir, manifest.FormatVersion, BackupFormatVersion)
+	}
+
+	rs := &restorer{client: hiarcClient, dir: dir, results: []RestoreResult{}}
+	var classifications []hiarc.Classification
+	var retentionPolicies []hiarc.RetentionPolicy
+	var legalHolds []hiarc.LegalHold
+	var users []hiarc.User
+	var groups []hiarc.Group
+	var memberships []BackupMembership
+	var collections []BackupCollection
+	var files []BackupFile
+	for name, v := range map[string]interface{}{
+		backupClassifications:   &classifications,
+		backupRetentionPolicies: &retentionPolicies,
+		backupLegalHolds:        &legalHolds,
+		backupUsers:             &users,
+		backupGroups:            &groups,
+		backupMemberships:       &memberships,
+		backupCollections:       &collections,
+		backupFiles:             &files,
+	} {
+		if err := readBackupFile(filepath.Join(dir, name), v); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := context.Background()
+	for _, c := range classifications {
+		cr := hiarc.CreateClassificationRequest{Key: c.Key, Name: c.Name, Description: c.Description, Metadata: c.Metadata}
+		_, r, err := hiarcClient.ClassificationApi.CreateClassification(ctx, cr, &hiarc.CreateClassificationOpts{})
+		rs.created("classification", c.Key, "ClassificationApi.CreateClassification", r, err)
+	}
+	for _, rp := range retentionPolicies {
+		cr := hiarc.CreateRetentionPolicyRequest{Key: rp.Key, Name: rp.Name, Description: rp.Description, Metadata: rp.Metadata, Seconds: rp.Seconds}
+		_, r, err := hiarcClient.RetentionPolicyApi.CreateRetentionPolicy(ctx, cr)
+		rs.created("retentionPolicy", rp.Key, "RetentionPolicyApi.CreateRetentionPolicy", r, err)
+	}
+	for _, lh := range legalHolds {
+		cr := hiarc.CreateLegalHoldRequest{Key: lh.Key, Name: lh.Name, Description: lh.Description, Metadata: lh.Metadata}
+		_, r, err := hiarcClient.LegalHoldApi.CreateLegalHold(ctx, cr)
+		rs.created("legalHold", lh.Key, "LegalHoldApi.CreateLegalHold", r, err)
+	}
+	for _, u := range users {
+		cr := hiarc.CreateUserRequest{Key: u.Key, Name: u.Name, Description: u.Description, Metadata: u.Metadata}
+		_, r, err := hiarcClient.UserApi.CreateUser(ctx, cr)
+		rs.created("user", u.Key, "UserApi.CreateUser", r, err)
+	}
+	for _, g := range groups {
+		cr := hiarc.CreateGroupRequest{Key: g.Key, Name: g.Name, Description: g.Description, Metadata: g.Metadata}
+		_, r, err := hiarcClient.GroupApi.CreateGroup(ctx, cr)
+		rs.created("group", g.Key, "GroupApi.CreateGroup", r, err)
+	}
+	for _, m := range memberships {
+		rs.restoreMembership(m)
+	}
+	for _, c := range collections {
+		cr := hiarc.CreateCollectionRequest{Key: c.Key, Name: c.Name, Description: c.Description, Metadata: c.Metadata}
+		_, r, err := hiarcClient.CollectionApi.CreateCollection(ctx, cr, &hiarc.CreateCollectionOpts{})
+		rs.created("collection", c.Key, "CollectionApi.CreateCollection", r, err)
+	}
+	for _, c := range collections {
+		for _, child := range c.Children {
+			_, r, err := hiarcClient.CollectionApi.AddChildToCollection(ctx, c.Key, child, &hiarc.AddChildToCollectionOpts{})
+			rs.created("collectionChild", c.Key+"/"+child, "CollectionApi.AddChildToCollection", r, err)
+		}
+	}
+	for _, f := range files {
+		rs.restoreFile(f)
+	}
+	for _, c := range collections {
+		for _, fk := range c.Files {
+			afcr := hiarc.AddFileToCollectionRequest{FileKey: fk}
+			_, r, err := hiarcClient.CollectionApi.AddFileToCollection(ctx, c.Key, afcr, &hiarc.AddFileToCollectionOpts{})
+			rs.created("collectionFile", c.Key+"/"+fk, "CollectionApi.AddFileToCollection", r, err)
+		}
+	}
+	for _, f := range files {
+		rs.restoreFileRetentionPolicies(f)
+	}
+	return rs.results, nil
+}
+
+// created records the result of a create call, counting a conflict as
+// already restored.
+func (rs *restorer) created(kind string, key string, operation string, r *http.Response, err error) {
+	result := RestoreResult{Type: kind, Key: key, Status: ImportStatusCreated}
+	if err != nil {
+		if apiErr := NewAPIError(operation, r, err); IsConflict(apiErr) {
+			result.Status = ImportStatusSkipped
+		} else {
+			result.Status = ImportStatusFailed
+			result.Error = apiErr.Error()
+		}
+	}
+	rs.add(result)
+}
+
+func (rs *restorer) add(result RestoreResult) {
+	log.Println(fmt.Sprintf("%s %s: %s", result.Type, result.Key, result.Status))
+	rs.results = append(rs.results, result)
+}
+
+func (rs *restorer) fail(kind string, key string, err error) {
+	rs.add(RestoreResult{Type: kind, Key: key, Status: ImportStatusFailed, Error: err.Error()})
+}
+
+func (rs *restorer) restoreMembership(m BackupMembership) {
+	key := m.GroupKey + "/" + m.UserKey
+	groups, r, err := rs.client.UserApi.GetGroupsForUser(context.Background(), m.UserKey, &hiarc.GetGroupsForUserOpts{})
+	if err != nil {
+		rs.fail("membership", key, NewAPIError("UserApi.GetGroupsForUser", r, err))
+		return
+	}
+	for _, g := range groups {
+		if g.Key == m.GroupKey {
+			rs.add(RestoreResult{Type: "membership", Key: key, Status: ImportStatusSkipped})
+			return
+		}
+	}
+	_, r, err = rs.client.GroupApi.AddUserToGroup(context.Background(), m.GroupKey, m.UserKey)
+	rs.created("membership", key, "GroupApi.AddUserToGroup", r, err)
+}
+
+// restoreFile uploads the exported content, or attaches to the storage of
+// the latest version when the export has no content.
+func (rs *restorer) restoreFile(f BackupFile) {
+	if _, _, err := rs.client.FileApi.GetFile(context.Background(), f.Key, &hiarc.GetFileOpts{}); err == nil {
+		rs.add(RestoreResult{Type: "file", Key: f.Key, Status: ImportStatusSkipped})
+		return
+	}
+
+	if f.ContentPath != "" {
+		t := NewTransfer(rs.client, "")
+		t.Progress = false
+		cf := hiarc.CreateFileRequest{Key: f.Key, Name: f.Name, Description: f.Description, Metadata: f.Metadata}
+		if _, err := t.CreateFile(filepath.Join(rs.dir, filepath.FromSlash(f.ContentPath)), cf); err != nil {
+			rs.fail("file", f.Key, err)
+			return
+		}
+		rs.add(RestoreResult{Type: "file", Key: f.Key, Status: ImportStatusCreated})
+		return
+	}
+
+	if len(f.Versions) == 0 {
+		rs.fail("file", f.Key, fmt.Errorf("the export has no content and no versions for %s", f.Key))
+		return
+	}
+	latest := f.Versions[len(f.Versions)-1]
+	ar := hiarc.AttachToExistingFileRequest{Name: f.Name, StorageService: latest.StorageService, StorageId: latest.StorageId}
+	if _, r, err := rs.client.FileApi.AttachToExisitingFile(context.Background(), f.Key, ar, &hiarc.AttachToExisitingFileOpts{}); err != nil {
+		rs.fail("file", f.Key, NewAPIError("FileApi.AttachToExisitingFile", r, err))
+		return
+	}
+	uf := hiarc.UpdateFileRequest{Description: f.Description, Metadata: f.Metadata}
+	if _, r, err := rs.client.FileApi.UpdateFile(context.Background(), f.Key, uf, &hiarc.UpdateFileOpts{}); err != nil {
+		rs.fail("file", f.Key, NewAPIError("FileApi.UpdateFile", r, err))
+		return
+	}
+	rs.add(RestoreResult{Type: "file", Key: f.Key, Status: ImportStatusCreated})
+}
+
+func (rs *restorer) restoreFileRetentionPolicies(f BackupFile) {
+	if len(f.RetentionPolicies) == 0 {
+		return
+	}
+	applied, r, err := rs.client.FileApi.GetRetentionPolicies(context.Background(), f.Key, &hiarc.GetRetentionPoliciesOpts{})
+	if err != nil {
+		rs.fail("fileRetentionPolicy", f.Key, NewAPIError("FileApi.GetRetentionPolicies", r, err))
+		return
+	}
+	have := map[string]bool{}
+	for _, a := range applied {
+		have[a.RetentionPolicy.Key] = true
+	}
+	for _, rp := range f.RetentionPolicies {
+		key := f.Key + "/" + rp
+		if have[rp] {
+			rs.add(RestoreResult{Type: "fileRetentionPolicy", Key: key, Status: ImportStatusSkipped})
+			continue
+		}
+		req := hiarc.AddRetentionPolicyToFileRequest{RetentionPolicyKey: rp}
+		_, r, err := rs.client.FileApi.AddRetentionPolicyToFile(context.Background(), f.Key, req, &hiarc.AddRetentionPolicyToFileOpts{})
+		rs.created("fileRetentionPolicy", key, "FileApi.AddRetentionPolicyToFile", r, err)
+	}
+}
+
+// readBackupFile decodes a JSON lines file of an export into v, a pointer
+// to a slice. A missing file is an empty list.
+func readBackupFile(p string, v interface{}) error {
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	items := []json.RawMessage{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			items = append(items, json.RawMessage(append([]byte{}, scanner.Bytes()...)))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(jsonData, v); err != nil {
+		return NewValidationError("Invalid export file %s: %v", p, err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVar(&exportOut, "out", "", "Directory to export to (required)")
+	exportCmd.MarkFlagRequired("out")
+	exportCmd.Flags().BoolVar(&exportContent, "content", false, "Include the latest content of every file")
+	exportCmd.Flags().StringArrayVar(&exportLegalHolds, "legal-hold", []string{}, "Key of a legal hold to export, can be repeated")
+
+	importCmd.Flags().StringVar(&importFrom, "from", "", "Restore an export made with hiarc export from this directory")
+}
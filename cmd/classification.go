@@ -23,10 +23,8 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 
 	hiarc "github.com/hiarcdb/hiarc-go-sdk"
 	"github.com/antihax/optional"
@@ -50,7 +48,7 @@ var createClassificationCmd = &cobra.Command{
 	Use:   "create [classification key]",
 	Short: "Create classification with a key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.CreateClassificationOpts{}
@@ -62,7 +60,7 @@ var createClassificationCmd = &cobra.Command{
 		if classificationMetadata != "" {
 			md, err := ConvertMetadataStringToObject(classificationMetadata)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			ccr.Metadata = md
 		}
@@ -75,11 +73,9 @@ var createClassificationCmd = &cobra.Command{
 
 		cc, r, err := hiarcClient.ClassificationApi.CreateClassification(context.Background(), ccr, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `ClassificationApi.CreateClassification``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("ClassificationApi.CreateClassification", r, err)
 		}
-		jsonData, err := json.MarshalIndent(cc, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(cc)
 	},
 }
 
@@ -87,7 +83,7 @@ var getClassificationCmd = &cobra.Command{
 	Use:   "get [classification key]",
 	Short: "Get classification by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.GetClassificationOpts{}
@@ -97,18 +93,16 @@ var getClassificationCmd = &cobra.Command{
 
 		classification, r, err := hiarcClient.ClassificationApi.GetClassification(context.Background(), args[0], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `ClassificationApi.GetClassification``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("ClassificationApi.GetClassification", r, err)
 		}
-		jsonData, err := json.MarshalIndent(classification, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(classification)
 	},
 }
 
 var getAllClassificationsCmd = &cobra.Command{
 	Use:   "all",
 	Short: "Get all classifications",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.GetAllClassificationsOpts{}
@@ -118,11 +112,9 @@ var getAllClassificationsCmd = &cobra.Command{
 
 		classifications, r, err := hiarcClient.ClassificationApi.GetAllClassifications(context.Background(), &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `ClassificationApi.GetAllClassifications``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("ClassificationApi.GetAllClassifications", r, err)
 		}
-		jsonData, err := json.MarshalIndent(classifications, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintList(cmd, NewSliceIterator(classifications))
 	},
 }
 
@@ -130,7 +122,7 @@ var updateClassificationCmd = &cobra.Command{
 	Use:   "update [classification key]",
 	Short: "Update classification by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.UpdateClassificationOpts{}
@@ -142,7 +134,7 @@ var updateClassificationCmd = &cobra.Command{
 		if classificationMetadata != "" {
 			md, err := ConvertMetadataStringToObject(classificationMetadata)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			uc.Metadata = md
 		}
@@ -154,11 +146,9 @@ var updateClassificationCmd = &cobra.Command{
 		}
 		classification, r, err := hiarcClient.ClassificationApi.UpdateClassification(context.Background(), args[0], uc, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `ClassificationApi.UpdateClassification``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("ClassificationApi.UpdateClassification", r, err)
 		}
-		jsonData, err := json.MarshalIndent(classification, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(classification)
 	},
 }
 
@@ -166,7 +156,7 @@ var deleteClassificationCmd = &cobra.Command{
 	Use:   "delete [classification key]",
 	Short: "Delete classification by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.DeleteClassificationOpts{}
@@ -176,17 +166,17 @@ var deleteClassificationCmd = &cobra.Command{
 
 		_, r, err := hiarcClient.ClassificationApi.DeleteClassification(context.Background(), args[0], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `ClassificationApi.DeleteClassification``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("ClassificationApi.DeleteClassification", r, err)
 		}
 		log.Println(fmt.Sprintf("Deleted classification: %s", args[0]))
+		return nil
 	},
 }
 
 var findClassificationCmd = &cobra.Command{
 	Use:   "find",
 	Short: "Find classification by query",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.FindClassificationOpts{}
@@ -194,22 +184,16 @@ var findClassificationCmd = &cobra.Command{
 			opts.XHiarcUserKey = optional.NewString(asUser)
 		}
 
-		queries := make([]map[string]interface{}, 0)
-		for i := range classificationQueries {
-			q, err := ConvertQueryToObject(classificationQueries[i])
-			if err != nil {
-				log.Fatal(err)
-			}
-			queries = append(queries, q)
+		queries, err := FindQuery(classificationQueries, whereFlag)
+		if err != nil {
+			return err
 		}
 		qr := hiarc.FindClassificationsRequest{Query: queries}
 		fc, r, err := hiarcClient.ClassificationApi.FindClassification(context.Background(), qr, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `ClassificationApi.FindClassification``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("ClassificationApi.FindClassification", r, err)
 		}
-		jsonData, err := json.MarshalIndent(fc, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintList(cmd, NewSliceIterator(fc))
 	},
 }
 
@@ -232,5 +216,7 @@ func init() {
 	updateClassificationCmd.Flags().StringVar(&classificationMetadata, "metadata", "", "Classification metadata")
 
 	findClassificationCmd.Flags().StringArrayVar(&classificationQueries, "query", make([]string, 0), "Classification query")
-	findClassificationCmd.MarkFlagRequired("query")
+	findClassificationCmd.Flags().StringVar(&whereFlag, "where", "", whereUse)
+	addListFlags(getAllClassificationsCmd)
+	addListFlags(findClassificationCmd)
 }
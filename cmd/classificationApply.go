@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/antihax/optional"
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"github.com/spf13/cobra"
+)
+
+const (
+	ClassifyStatusClassified = "classified"
+	ClassifyStatusSkipped    = "skipped"
+	ClassifyStatusFailed     = "failed"
+)
+
+var (
+	classifyCollection  string
+	classifyRecursive   bool
+	classifyQueries     []string
+	classifyWhere       string
+	classifyConcurrency int
+)
+
+// ClassifyResult is what classification apply did with one file.
+type ClassifyResult struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+var applyClassificationCmd = &cobra.Command{
+	Use:   "apply [classification key]",
+	Short: "Classify every file in a collection or matching a query",
+	Long: `Apply a classification to the files in a collection, and with --recursive
+in the collections below it, or to the files in any collection matching
+--query or --where, or to the files in a collection matching the query when
+both are given. Files are classified concurrently and a result for each file
+is printed. Hiarc can't list the classifications of a file, so every file is
+classified; those Hiarc reports as already having the classification are
+skipped.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if classifyCollection == "" && classifyWhere == "" && len(classifyQueries) == 0 {
+			return NewValidationError("Pass --collection, --query or --where to choose the files to classify")
+		}
+		if classifyConcurrency < 1 {
+			return NewValidationError("--concurrency must be at least 1")
+		}
+		hiarcClient := ConfigureHiarcClient()
+		asUser, _ := rootCmd.Flags().GetString("as-user")
+		selector, err := NewFileSelector(hiarcClient, asUser, classifyCollection, classifyRecursive, classifyQueries, classifyWhere)
+		if err != nil {
+			return err
+		}
+		if _, err := getClassification(hiarcClient, asUser, args[0]); err != nil {
+			return err
+		}
+		files, err := selector.All()
+		if err != nil {
+			return err
+		}
+
+		results := classifyAll(hiarcClient, asUser, files, args[0], classifyConcurrency)
+		counts := map[string]int{}
+		for _, r := range results {
+			counts[r.Status]++
+		}
+		if err := PrintResult(results); err != nil {
+			return err
+		}
+		log.Println(fmt.Sprintf("Classified %d files, skipped %d, failed %d", counts[ClassifyStatusClassified], counts[ClassifyStatusSkipped], counts[ClassifyStatusFailed]))
+		if counts[ClassifyStatusFailed] > 0 {
+			return NewPartialFailure(counts[ClassifyStatusFailed], len(results), "files failed to be classified")
+		}
+		return nil
+	},
+}
+
+// classifyAll applies the classification key to files on a pool of workers.
+func classifyAll(client *hiarc.APIClient, asUser string, files []hiarc.File, key string, workers int) []ClassifyResult {
+	results := make([]ClassifyResult, len(files))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				f := files[i]
+				results[i] = ClassifyResult{Key: f.Key, Status: ClassifyStatusClassified}
+				if err := ClassifyFile(client, asUser, f.Key, key); IsConflict(err) {
+					results[i].Status = ClassifyStatusSkipped
+				} else if err != nil {
+					results[i].Status = ClassifyStatusFailed
+					results[i].Error = err.Error()
+				}
+
+				mu.Lock()
+				done++
+				log.Println(fmt.Sprintf("[%d/%d] %s: %s", done, len(files), f.Key, results[i].Status))
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range files {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return results
+}
+
+// ClassifyFile applies the classification key to the file with fileKey.
+func ClassifyFile(client *hiarc.APIClient, asUser string, fileKey string, key string) error {
+	opts := hiarc.AddClassificationToFileOpts{}
+	if asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(asUser)
+	}
+	ac := hiarc.AddClassificationToFileRequest{ClassificationKey: key}
+	if _, r, err := client.FileApi.AddClassificationToFile(context.Background(), fileKey, ac, &opts); err != nil {
+		return NewAPIError("FileApi.AddClassificationToFile", r, err)
+	}
+	return nil
+}
+
+func getClassification(client *hiarc.APIClient, asUser string, key string) (hiarc.Classification, error) {
+	opts := hiarc.GetClassificationOpts{}
+	if asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(asUser)
+	}
+	c, r, err := client.ClassificationApi.GetClassification(context.Background(), key, &opts)
+	if err != nil {
+		return c, NewAPIError("ClassificationApi.GetClassification", r, err)
+	}
+	return c, nil
+}
+
+func init() {
+	classificationCmd.AddCommand(applyClassificationCmd)
+
+	applyClassificationCmd.Flags().StringVar(&classifyCollection, "collection", "", "Classify the files in this collection")
+	applyClassificationCmd.Flags().BoolVar(&classifyRecursive, "recursive", false, "Also classify the files in the collections below --collection")
+	applyClassificationCmd.Flags().StringArrayVar(&classifyQueries, "query", make([]string, 0), "File query")
+	applyClassificationCmd.Flags().StringVar(&classifyWhere, "where", "", whereUse)
+	applyClassificationCmd.Flags().IntVar(&classifyConcurrency, "concurrency", 4, "Number of files to classify at the same time")
+}
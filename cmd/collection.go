@@ -2,10 +2,8 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"strings"
 
 	hiarc "github.com/hiarcdb/hiarc-go-sdk"
@@ -18,6 +16,9 @@ var (
 	collectionName        string
 	collectionDescription string
 	collectionQueries     []string
+
+	collectionDeleteRecursive bool
+	collectionDeleteDryRun    bool
 )
 
 var collectionCmd = &cobra.Command{
@@ -30,7 +31,7 @@ var createCollectionCmd = &cobra.Command{
 	Use:   "create [collection key]",
 	Short: "Create a collection",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.CreateCollectionOpts{}
@@ -42,7 +43,7 @@ var createCollectionCmd = &cobra.Command{
 		if collectionMetadata != "" {
 			md, err := ConvertMetadataStringToObject(collectionMetadata)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			ccr.Metadata = md
 		}
@@ -54,11 +55,9 @@ var createCollectionCmd = &cobra.Command{
 		}
 		collection, r, err := hiarcClient.CollectionApi.CreateCollection(context.Background(), ccr, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `CollectionApi.CreateCollection``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("CollectionApi.CreateCollection", r, err)
 		}
-		jsonData, err := json.MarshalIndent(collection, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(collection)
 	},
 }
 
@@ -66,7 +65,7 @@ var getCollectionCmd = &cobra.Command{
 	Use:   "get [collection key]",
 	Short: "Get collection by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.GetCollectionOpts{}
@@ -76,18 +75,16 @@ var getCollectionCmd = &cobra.Command{
 
 		collection, r, err := hiarcClient.CollectionApi.GetCollection(context.Background(), args[0], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `CollectionApi.GetCollection``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("CollectionApi.GetCollection", r, err)
 		}
-		jsonData, err := json.MarshalIndent(collection, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(collection)
 	},
 }
 
 var getAllCollectionsCmd = &cobra.Command{
 	Use:   "all",
 	Short: "Get all collections",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.GetAllCollectionsOpts{}
@@ -97,11 +94,9 @@ var getAllCollectionsCmd = &cobra.Command{
 
 		collections, r, err := hiarcClient.CollectionApi.GetAllCollections(context.Background(), &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `CollectionApi.GetAllCollections``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("CollectionApi.GetAllCollections", r, err)
 		}
-		jsonData, err := json.MarshalIndent(collections, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintList(cmd, NewSliceIterator(collections))
 	},
 }
 
@@ -109,7 +104,7 @@ var getChildrenForCollectionCmd = &cobra.Command{
 	Use:   "children [collection key]",
 	Short: "Get all child collections in a collection",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.GetCollectionChildrenOpts{}
@@ -119,11 +114,9 @@ var getChildrenForCollectionCmd = &cobra.Command{
 
 		collection, r, err := hiarcClient.CollectionApi.GetCollectionChildren(context.Background(), args[0], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `CollectionApi.GetCollectionChildren``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("CollectionApi.GetCollectionChildren", r, err)
 		}
-		jsonData, err := json.MarshalIndent(collection, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(collection)
 	},
 }
 
@@ -131,7 +124,7 @@ var getFilesForCollectionCmd = &cobra.Command{
 	Use:   "files [collection key]",
 	Short: "Get all files in a collection",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.GetCollectionFilesOpts{}
@@ -141,11 +134,9 @@ var getFilesForCollectionCmd = &cobra.Command{
 
 		collection, r, err := hiarcClient.CollectionApi.GetCollectionFiles(context.Background(), args[0], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `CollectionApi.GetCollectionFiles``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("CollectionApi.GetCollectionFiles", r, err)
 		}
-		jsonData, err := json.MarshalIndent(collection, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(collection)
 	},
 }
 
@@ -153,7 +144,7 @@ var getItemsForCollectionCmd = &cobra.Command{
 	Use:   "items [collection key]",
 	Short: "Get all files and child collections in a collection",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.GetCollectionItemsOpts{}
@@ -163,11 +154,9 @@ var getItemsForCollectionCmd = &cobra.Command{
 
 		collection, r, err := hiarcClient.CollectionApi.GetCollectionItems(context.Background(), args[0], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `CollectionApi.GetCollectionFiles``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("CollectionApi.GetCollectionItems", r, err)
 		}
-		jsonData, err := json.MarshalIndent(collection, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(collection)
 	},
 }
 
@@ -175,7 +164,7 @@ var updateCollectionCmd = &cobra.Command{
 	Use:   "update [collection key]",
 	Short: "Update a collection",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.UpdateCollectionOpts{}
@@ -187,7 +176,7 @@ var updateCollectionCmd = &cobra.Command{
 		if collectionMetadata != "" {
 			md, err := ConvertMetadataStringToObject(collectionMetadata)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			ucr.Metadata = md
 		}
@@ -199,19 +188,63 @@ var updateCollectionCmd = &cobra.Command{
 		}
 		collection, r, err := hiarcClient.CollectionApi.UpdateCollection(context.Background(), args[0], ucr, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `CollectionApi.UpdateCollection``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("CollectionApi.UpdateCollection", r, err)
 		}
-		jsonData, err := json.MarshalIndent(collection, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(collection)
 	},
 }
 
 var deleteCollectionCmd = &cobra.Command{
 	Use:   "delete [collection key]",
 	Short: "Delete a collection",
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `Delete a collection. With --recursive the files in it and in the
+collections below it are deleted first, then the collections, deepest first.
+Files under a retention policy that hasn't expired, and files that are also
+in collections outside of the subtree, are kept along with the collections
+holding them. Collections below that are also children of a collection
+outside of the subtree are kept with everything below them. The result of
+each file and collection is printed.
+
+Hiarc has no endpoint to read the legal holds on a file, so files under
+legal hold are only kept when Hiarc refuses to delete them, which is
+reported as failed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if collectionDeleteRecursive {
+			if !collectionDeleteDryRun {
+				if err := ConfirmDestructive(fmt.Sprintf("delete collection %s and its unprotected contents", args[0])); err != nil {
+					return err
+				}
+			}
+			hiarcClient := ConfigureHiarcClient()
+			asUser, _ := rootCmd.Flags().GetString("as-user")
+			results, err := DeleteCollectionRecursive(hiarcClient, asUser, args[0], collectionDeleteDryRun)
+			if err != nil {
+				return err
+			}
+			if err := PrintResult(results); err != nil {
+				return err
+			}
+			failed, attempted := 0, 0
+			for _, r := range results {
+				if r.Status == DeleteStatusFailed {
+					failed++
+				}
+				if r.Status != DeleteStatusKept {
+					attempted++
+				}
+			}
+			if failed > 0 {
+				return NewPartialFailure(failed, attempted, "deletions failed")
+			}
+			return nil
+		}
+		if collectionDeleteDryRun {
+			return NewValidationError("--dry-run only applies with --recursive")
+		}
+		if err := ConfirmDestructive(fmt.Sprintf("delete collection %s", args[0])); err != nil {
+			return err
+		}
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.DeleteCollectionOpts{}
@@ -221,11 +254,10 @@ var deleteCollectionCmd = &cobra.Command{
 
 		_, r, err := hiarcClient.CollectionApi.DeleteCollection(context.Background(), args[0], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `CollectionApi.DeleteCollection``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
-			log.Fatal("Couldn't delete collection")
+			return NewAPIError("CollectionApi.DeleteCollection", r, err)
 		}
 		log.Println(fmt.Sprintf("Deleted collection: %s", args[0]))
+		return nil
 	},
 }
 
@@ -233,7 +265,7 @@ var removeFileFromCollectionCmd = &cobra.Command{
 	Use:   "remove-file [collection key] [file key]",
 	Short: "Remove a file from a collection",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.RemoveFileFromCollectionOpts{}
@@ -243,11 +275,10 @@ var removeFileFromCollectionCmd = &cobra.Command{
 
 		_, r, err := hiarcClient.CollectionApi.RemoveFileFromCollection(context.Background(), args[0], args[1], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `CollectionApi.RemoveFileFromCollection``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
-			log.Fatal("Couldn't remove file from collection")
+			return NewAPIError("CollectionApi.RemoveFileFromCollection", r, err)
 		}
 		log.Println(fmt.Sprintf("Removed file %s from collection: %s", args[1], args[0]))
+		return nil
 	},
 }
 
@@ -255,11 +286,10 @@ var addUserToCollectionCmd = &cobra.Command{
 	Use:   "add-user [collection key] [user key] [access level]",
 	Short: "Add a user to a collection",
 	Args:  cobra.ExactArgs(3),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		accessLevel := strings.ToUpper(args[2])
 		if !IsValidAccessLevel(accessLevel) {
-			log.Println(fmt.Sprintf("%s is not a valid access level", accessLevel))
-			log.Fatal(fmt.Sprintf("Choose from the following: %s, %s, %s, or %s", string(hiarc.CO_OWNER), string(hiarc.READ_WRITE), string(hiarc.READ_ONLY), string(hiarc.UPLOAD_ONLY)))
+			return NewValidationError("%s is not a valid access level. Choose from the following: %s, %s, %s, or %s", accessLevel, string(hiarc.CO_OWNER), string(hiarc.READ_WRITE), string(hiarc.READ_ONLY), string(hiarc.UPLOAD_ONLY))
 		}
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
@@ -270,16 +300,15 @@ var addUserToCollectionCmd = &cobra.Command{
 
 		al, err := GetAccessLevelFromString(accessLevel)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		aucr := hiarc.AddUserToCollectionRequest{UserKey: args[1], AccessLevel: al}
 		_, r, err := hiarcClient.CollectionApi.AddUserToCollection(context.Background(), args[0], aucr, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `CollectionApi.AddUserToCollection``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
-			log.Fatal("Couldn't add user to collection")
+			return NewAPIError("CollectionApi.AddUserToCollection", r, err)
 		}
 		log.Println(fmt.Sprintf("Added user %s to collection %s with access level %s", args[1], args[0], accessLevel))
+		return nil
 	},
 }
 
@@ -287,11 +316,10 @@ var addGroupToCollectionCmd = &cobra.Command{
 	Use:   "add-group [collection key] [group key] [access level]",
 	Short: "Add a group to a collection",
 	Args:  cobra.ExactArgs(3),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		accessLevel := strings.ToUpper(args[2])
 		if !IsValidAccessLevel(accessLevel) {
-			log.Println(fmt.Sprintf("%s is not a valid access level", accessLevel))
-			log.Fatal(fmt.Sprintf("Choose from the following: %s, %s, %s, or %s", string(hiarc.CO_OWNER), string(hiarc.READ_WRITE), string(hiarc.READ_ONLY), string(hiarc.UPLOAD_ONLY)))
+			return NewValidationError("%s is not a valid access level. Choose from the following: %s, %s, %s, or %s", accessLevel, string(hiarc.CO_OWNER), string(hiarc.READ_WRITE), string(hiarc.READ_ONLY), string(hiarc.UPLOAD_ONLY))
 		}
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
@@ -302,16 +330,15 @@ var addGroupToCollectionCmd = &cobra.Command{
 
 		al, err := GetAccessLevelFromString(accessLevel)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		agcr := hiarc.AddGroupToCollectionRequest{GroupKey: args[1], AccessLevel: al}
 		_, r, err := hiarcClient.CollectionApi.AddGroupToCollection(context.Background(), args[0], agcr, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `CollectionApi.AddGroupToCollection``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
-			log.Fatal("Couldn't add group to collection")
+			return NewAPIError("CollectionApi.AddGroupToCollection", r, err)
 		}
 		log.Println(fmt.Sprintf("Added group %s to collection %s with access level %s", args[1], args[0], accessLevel))
+		return nil
 	},
 }
 
@@ -319,7 +346,7 @@ var addFileToCollectionCmd = &cobra.Command{
 	Use:   "add-file [collection key] [file key]",
 	Short: "Add a file to a collection",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.AddFileToCollectionOpts{}
@@ -330,11 +357,10 @@ var addFileToCollectionCmd = &cobra.Command{
 		afcr := hiarc.AddFileToCollectionRequest{FileKey: args[1]}
 		_, r, err := hiarcClient.CollectionApi.AddFileToCollection(context.Background(), args[0], afcr, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `CollectionApi.AddFileToCollection``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
-			log.Fatal("Couldn't add file to collection")
+			return NewAPIError("CollectionApi.AddFileToCollection", r, err)
 		}
 		log.Println(fmt.Sprintf("Added file %s to collection %s", args[1], args[0]))
+		return nil
 	},
 }
 
@@ -342,7 +368,7 @@ var addChildToCollectionCmd = &cobra.Command{
 	Use:   "add-child [parent collection key] [child collection key]",
 	Short: "Add a child to a collection",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.AddChildToCollectionOpts{}
@@ -351,18 +377,17 @@ var addChildToCollectionCmd = &cobra.Command{
 		}
 		_, r, err := hiarcClient.CollectionApi.AddChildToCollection(context.Background(), args[0], args[1], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `CollectionApi.AddChildToCollection``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
-			log.Fatal("Couldn't add child to collection")
+			return NewAPIError("CollectionApi.AddChildToCollection", r, err)
 		}
 		log.Println(fmt.Sprintf("Added child %s to collection %s", args[1], args[0]))
+		return nil
 	},
 }
 
 var findCollectionCmd = &cobra.Command{
 	Use:   "find",
 	Short: "Find collection by query",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.FindCollectionOpts{}
@@ -370,22 +395,16 @@ var findCollectionCmd = &cobra.Command{
 			opts.XHiarcUserKey = optional.NewString(asUser)
 		}
 
-		queries := make([]map[string]interface{}, 0)
-		for i := range collectionQueries {
-			q, err := ConvertQueryToObject(collectionQueries[i])
-			if err != nil {
-				log.Fatal(err)
-			}
-			queries = append(queries, q)
+		queries, err := FindQuery(collectionQueries, whereFlag)
+		if err != nil {
+			return err
 		}
 		qr := hiarc.FindCollectionsRequest{Query: queries}
 		fc, r, err := hiarcClient.CollectionApi.FindCollection(context.Background(), qr, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `CollectionApi.FindCollection``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("CollectionApi.FindCollection", r, err)
 		}
-		jsonData, err := json.MarshalIndent(fc, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintList(cmd, NewSliceIterator(fc))
 	},
 }
 
@@ -395,6 +414,9 @@ func init() {
 	collectionCmd.AddCommand(getCollectionCmd)
 	collectionCmd.AddCommand(updateCollectionCmd)
 	collectionCmd.AddCommand(deleteCollectionCmd)
+	addConfirmFlag(deleteCollectionCmd)
+	deleteCollectionCmd.Flags().BoolVar(&collectionDeleteRecursive, "recursive", false, "Also delete the files and collections below it, keeping protected files")
+	deleteCollectionCmd.Flags().BoolVar(&collectionDeleteDryRun, "dry-run", false, "Print what --recursive would delete without deleting anything")
 	collectionCmd.AddCommand(removeFileFromCollectionCmd)
 	collectionCmd.AddCommand(addGroupToCollectionCmd)
 	collectionCmd.AddCommand(addUserToCollectionCmd)
@@ -416,5 +438,7 @@ func init() {
 	updateCollectionCmd.Flags().StringVar(&collectionMetadata, "metadata", "", "Collection metadata")
 
 	findCollectionCmd.Flags().StringArrayVar(&collectionQueries, "query", make([]string, 0), "Collection query")
-	findCollectionCmd.MarkFlagRequired("query")
+	findCollectionCmd.Flags().StringVar(&whereFlag, "where", "", whereUse)
+	addListFlags(getAllCollectionsCmd)
+	addListFlags(findCollectionCmd)
 }
@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antihax/optional"
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"github.com/spf13/cobra"
+)
+
+const defaultManifestName = ".hiarc-manifest.json"
+
+var (
+	collectionDownloadPath        string
+	collectionDownloadManifest    string
+	collectionDownloadConcurrency int
+)
+
+// DownloadManifest records which Hiarc file each downloaded local path came from.
+type DownloadManifest struct {
+	Collection   string          `json:"collection"`
+	DownloadedAt time.Time       `json:"downloadedAt"`
+	Files        []ManifestEntry `json:"files"`
+	Cycles       []string        `json:"cycles,omitempty"`
+}
+
+// ManifestEntry is one downloaded file and the version it was downloaded at.
+type ManifestEntry struct {
+	Path             string    `json:"path"`
+	FileKey          string    `json:"fileKey"`
+	CollectionKey    string    `json:"collectionKey"`
+	VersionCount     float32   `json:"versionCount"`
+	StorageId        string    `json:"storageId,omitempty"`
+	VersionCreatedAt time.Time `json:"versionCreatedAt"`
+	Status           string    `json:"status"`
+	Error            string    `json:"error,omitempty"`
+}
+
+const (
+	DownloadStatusDownloaded = "downloaded"
+	DownloadStatusFailed     = "failed"
+)
+
+var collectionDownloadCmd = &cobra.Command{
+	Use:   "download [collection key]",
+	Short: "Download a collection and its children to your local system",
+	Long: `Download every file in a collection and its child collections, recreating
+the hierarchy as local folders named after the collections. Name collisions
+are resolved by appending a number, collections that would form a cycle are
+skipped, and a manifest mapping local paths to file keys and versions is
+written to the download path.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := os.Stat(collectionDownloadPath)
+		if err != nil {
+			return err
+		}
+		if !s.IsDir() {
+			return NewValidationError("Download path must be a directory.")
+		}
+		if collectionDownloadConcurrency < 1 {
+			return NewValidationError("--concurrency must be at least 1")
+		}
+
+		hiarcClient := ConfigureHiarcClient()
+		asUser, _ := rootCmd.Flags().GetString("as-user")
+		manifestPath := collectionDownloadManifest
+		if manifestPath == "" {
+			manifestPath = filepath.Join(collectionDownloadPath, defaultManifestName)
+		}
+		w := newCollectionWalker(hiarcClient, asUser)
+		// A file with the manifest's name is given another one, so neither
+		// overwrites the other.
+		w.used[strings.ToLower(filepath.Clean(manifestPath))] = true
+		if err := w.walk(args[0], collectionDownloadPath, []string{}); err != nil {
+			return err
+		}
+		for dir := range w.dirKeys {
+			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+				return err
+			}
+		}
+
+		entries := w.download(collectionDownloadConcurrency)
+		manifest := DownloadManifest{
+			Collection:   args[0],
+			DownloadedAt: time.Now().UTC(),
+			Files:        entries,
+			Cycles:       w.cycles,
+		}
+		if err := WriteManifest(manifestPath, manifest); err != nil {
+			return err
+		}
+
+		if err := PrintResult(entries); err != nil {
+			return err
+		}
+		failed := 0
+		for _, e := range entries {
+			if e.Status == DownloadStatusFailed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return NewPartialFailure(failed, len(entries), "files failed to download")
+		}
+		return nil
+	},
+}
+
+type collectionDownloadJob struct {
+	file          hiarc.File
+	collectionKey string
+	localPath     string
+}
+
+// collectionWalker maps a collection tree to local paths without touching
+// the local file system.
+type collectionWalker struct {
+	client  *hiarc.APIClient
+	asUser  string
+	jobs    []collectionDownloadJob
+	cycles  []string
+	used    map[string]bool
+	dirKeys map[string]string
+}
+
+func newCollectionWalker(client *hiarc.APIClient, asUser string) *collectionWalker {
+	return &collectionWalker{
+		client:  client,
+		asUser:  asUser,
+		used:    map[string]bool{},
+		dirKeys: map[string]string{},
+	}
+}
+
+// walk maps the collection to dir, queues its files and descends into its
+// children. ancestors holds the keys of the collections above key.
+func (w *collectionWalker) walk(key string, dir string, ancestors []string) error {
+	for _, a := range ancestors {
+		if a == key {
+			cycle := strings.Join(append(ancestors, key), " -> ")
+			log.Println(fmt.Sprintf("Skipping collection %s, it would create a cycle: %s", key, cycle))
+			w.cycles = append(w.cycles, cycle)
+			return nil
+		}
+	}
+	w.dirKeys[dir] = key
+	ancestors = append(ancestors, key)
+
+	filesOpts := hiarc.GetCollectionFilesOpts{}
+	if w.asUser != "" {
+		filesOpts.XHiarcUserKey = optional.NewString(w.asUser)
+	}
+	files, r, err := w.client.CollectionApi.GetCollectionFiles(context.Background(), key, &filesOpts)
+	if err != nil {
+		return NewAPIError("CollectionApi.GetCollectionFiles", r, err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+	for _, f := range files {
+		name := f.Name
+		if name == "" {
+			name = f.Key
+		}
+		w.jobs = append(w.jobs, collectionDownloadJob{
+			file:          f,
+			collectionKey: key,
+			localPath:     w.uniquePath(filepath.Join(dir, SafeFileName(name))),
+		})
+	}
+
+	childOpts := hiarc.GetCollectionChildrenOpts{}
+	if w.asUser != "" {
+		childOpts.XHiarcUserKey = optional.NewString(w.asUser)
+	}
+	children, r, err := w.client.CollectionApi.GetCollectionChildren(context.Background(), key, &childOpts)
+	if err != nil {
+		return NewAPIError("CollectionApi.GetCollectionChildren", r, err)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Key < children[j].Key })
+	for _, c := range children {
+		name := c.Name
+		if name == "" {
+			name = c.Key
+		}
+		childDir := w.uniquePath(filepath.Join(dir, SafeFileName(name)))
+		if err := w.walk(c.Key, childDir, ancestors); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniquePath returns p, or p with a number added before the extension when
+// another file or folder of this download already uses it.
+func (w *collectionWalker) uniquePath(p string) string {
+	ext := filepath.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	candidate := p
+	for i := 2; w.used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	w.used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+func (w *collectionWalker) download(workers int) []ManifestEntry {
+	entries := make([]ManifestEntry, len(w.jobs))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				entries[i] = w.downloadOne(w.jobs[i])
+
+				mu.Lock()
+				done++
+				log.Println(fmt.Sprintf("[%d/%d] %s -> %s: %s", done, len(w.jobs), w.jobs[i].file.Key, entries[i].Path, entries[i].Status))
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range w.jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return entries
+}
+
+func (w *collectionWalker) downloadOne(j collectionDownloadJob) ManifestEntry {
+	rel, err := filepath.Rel(collectionDownloadPath, j.localPath)
+	if err != nil {
+		rel = j.localPath
+	}
+	entry := ManifestEntry{
+		Path:          filepath.ToSlash(rel),
+		FileKey:       j.file.Key,
+		CollectionKey: j.collectionKey,
+		VersionCount:  j.file.VersionCount,
+		Status:        DownloadStatusDownloaded,
+	}
+
+	versionOpts := hiarc.GetVersionsOpts{}
+	if w.asUser != "" {
+		versionOpts.XHiarcUserKey = optional.NewString(w.asUser)
+	}
+	versions, r, err := w.client.FileApi.GetVersions(context.Background(), j.file.Key, &versionOpts)
+	if err == nil && len(versions) > 0 {
+		latest := versions[len(versions)-1]
+		entry.StorageId = latest.StorageId
+		entry.VersionCreatedAt = latest.CreatedAt
+	} else if err != nil {
+		entry.Status = DownloadStatusFailed
+		entry.Error = NewAPIError("FileApi.GetVersions", r, err).Error()
+		return entry
+	}
+
+	if err := DownloadFileToPath(w.client, j.file.Key, w.asUser, j.localPath); err != nil {
+		entry.Status = DownloadStatusFailed
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+// SafeFileName replaces characters that can't be used in local file names.
+func SafeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 32 {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "." || name == ".." || name == "" {
+		return "_"
+	}
+	return name
+}
+
+func WriteManifest(path string, manifest DownloadManifest) error {
+	jsonData, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, jsonData, 0644)
+}
+
+func init() {
+	collectionCmd.AddCommand(collectionDownloadCmd)
+
+	collectionDownloadCmd.Flags().StringVar(&collectionDownloadPath, "path", "", "Local directory to download into (required)")
+	collectionDownloadCmd.MarkFlagRequired("path")
+	collectionDownloadCmd.Flags().StringVar(&collectionDownloadManifest, "manifest", "", "Where to write the manifest (default is "+defaultManifestName+" in the download path)")
+	collectionDownloadCmd.Flags().IntVar(&collectionDownloadConcurrency, "concurrency", 4, "Number of files to download at the same time")
+	collectionDownloadCmd.Flags().IntVar(&transferRetries, "retries", defaultRetries, transferRetriesUse)
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"sort"
+
+	"github.com/antihax/optional"
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+)
+
+// FileWalker lists the files of collections one collection at a time. Each
+// file is listed once and cycles in the hierarchy are only walked once.
+type FileWalker struct {
+	client          *hiarc.APIClient
+	asUser          string
+	recursive       bool
+	queue           []string
+	seenFiles       map[string]bool
+	seenCollections map[string]bool
+}
+
+// NewFileWalker walks the collections in roots and, when recursive is set,
+// every collection below them.
+func NewFileWalker(client *hiarc.APIClient, asUser string, roots []string, recursive bool) *FileWalker {
+	return &FileWalker{
+		client:          client,
+		asUser:          asUser,
+		recursive:       recursive,
+		queue:           append([]string{}, roots...),
+		seenFiles:       map[string]bool{},
+		seenCollections: map[string]bool{},
+	}
+}
+
+// NewAllFilesWalker walks every collection. Hiarc has no endpoint to list
+// files, so files that aren't in any collection are missed.
+func NewAllFilesWalker(client *hiarc.APIClient, asUser string) (*FileWalker, error) {
+	opts := hiarc.GetAllCollectionsOpts{}
+	if asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(asUser)
+	}
+	collections, r, err := client.CollectionApi.GetAllCollections(context.Background(), &opts)
+	if err != nil {
+		return nil, NewAPIError("CollectionApi.GetAllCollections", r, err)
+	}
+	keys := make([]string, len(collections))
+	for i, c := range collections {
+		keys[i] = c.Key
+	}
+	return NewFileWalker(client, asUser, keys, false), nil
+}
+
+// Next returns the files of the next collection that weren't listed before,
+// and false once every collection has been walked.
+func (w *FileWalker) Next() ([]hiarc.File, bool, error) {
+	for len(w.queue) > 0 {
+		k := w.queue[0]
+		w.queue = w.queue[1:]
+		if w.seenCollections[k] {
+			continue
+		}
+		w.seenCollections[k] = true
+
+		filesOpts := hiarc.GetCollectionFilesOpts{}
+		if w.asUser != "" {
+			filesOpts.XHiarcUserKey = optional.NewString(w.asUser)
+		}
+		fs, r, err := w.client.CollectionApi.GetCollectionFiles(context.Background(), k, &filesOpts)
+		if err != nil {
+			return nil, false, NewAPIError("CollectionApi.GetCollectionFiles", r, err)
+		}
+
+		if w.recursive {
+			childOpts := hiarc.GetCollectionChildrenOpts{}
+			if w.asUser != "" {
+				childOpts.XHiarcUserKey = optional.NewString(w.asUser)
+			}
+			children, r, err := w.client.CollectionApi.GetCollectionChildren(context.Background(), k, &childOpts)
+			if err != nil {
+				return nil, false, NewAPIError("CollectionApi.GetCollectionChildren", r, err)
+			}
+			for _, c := range children {
+				w.queue = append(w.queue, c.Key)
+			}
+		}
+
+		files := []hiarc.File{}
+		for _, f := range fs {
+			if !w.seenFiles[f.Key] {
+				w.seenFiles[f.Key] = true
+				files = append(files, f)
+			}
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+		return files, true, nil
+	}
+	return nil, false, nil
+}
+
+// All walks the remaining collections and returns their files sorted by key.
+func (w *FileWalker) All() ([]hiarc.File, error) {
+	all := []hiarc.File{}
+	for {
+		files, more, err := w.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+		all = append(all, files...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Key < all[j].Key })
+	return all, nil
+}
+
+// CollectionFiles lists the files in the collection key and, when recursive
+// is set, in every collection below it.
+func CollectionFiles(client *hiarc.APIClient, asUser string, key string, recursive bool) ([]hiarc.File, error) {
+	return NewFileWalker(client, asUser, []string{key}, recursive).All()
+}
+
+// AllCollectionFiles lists the files in every collection.
+func AllCollectionFiles(client *hiarc.APIClient, asUser string) ([]hiarc.File, error) {
+	w, err := NewAllFilesWalker(client, asUser)
+	if err != nil {
+		return nil, err
+	}
+	return w.All()
+}
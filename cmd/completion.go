@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	completionCacheFileName = "completion-cache.json"
+	// completionCacheTTL is how long keys fetched for completion are reused,
+	// so pressing tab a few times in a row only queries Hiarc once.
+	completionCacheTTL = time.Minute
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish|powershell]",
+	Short: "Generate a shell completion script",
+	Long: `Generate a completion script for your shell. Besides commands and flags
+it completes access levels, profile names, and the keys of users, groups,
+collections, files, classifications and retention policies, which are
+fetched from Hiarc with the current --profile and --as-user and cached for a
+minute in ~/.hiarc/completion-cache.json.
+
+Bash:
+  source <(hiarc completion bash)
+  # or, to load it in every session:
+  hiarc completion bash > /etc/bash_completion.d/hiarc
+
+Zsh:
+  hiarc completion zsh > "${fpath[1]}/_hiarc"
+
+Fish:
+  hiarc completion fish > ~/.config/fish/completions/hiarc.fish
+
+PowerShell:
+  hiarc completion powershell | Out-String | Invoke-Expression
+
+The zsh and PowerShell scripts complete commands and flags only. In zsh,
+keys are completed when the bash script is loaded with bashcompinit.`,
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	Args:      cobra.ExactValidArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch args[0] {
+		case "bash":
+			return rootCmd.GenBashCompletion(os.Stdout)
+		case "zsh":
+			return rootCmd.GenZshCompletion(os.Stdout)
+		case "fish":
+			return rootCmd.GenFishCompletion(os.Stdout, true)
+		default:
+			return rootCmd.GenPowerShellCompletion(os.Stdout)
+		}
+	},
+}
+
+type completionCacheEntry struct {
+	Keys      []string  `json:"keys"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// RegisterCompletions completes the arguments of every command that takes
+// keys, and the values of the --profile, --as-user and --output flags. It
+// runs once the command tree is complete.
+func RegisterCompletions() {
+	registerArgCompletions(rootCmd)
+	rootCmd.RegisterFlagCompletionFunc("profile", completeKind(ResourceProfiles))
+	rootCmd.RegisterFlagCompletionFunc("as-user", completeKind(ResourceUsers))
+	rootCmd.RegisterFlagCompletionFunc("output", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{OutputJSON, OutputJSONLines, OutputYAML, OutputTable, OutputCSV, OutputGoTemplate, OutputJSONPath}, cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+func registerArgCompletions(c *cobra.Command) {
+	if c.ValidArgsFunction == nil && len(c.ValidArgs) == 0 && strings.Contains(c.Use, "[") {
+		c.ValidArgsFunction = completeArgs
+	}
+	for _, sub := range c.Commands() {
+		registerArgCompletions(sub)
+	}
+}
+
+// completeArgs completes the argument being typed from the placeholders in
+// the command's Use string, falling back to file names for the others.
+func completeArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	kind, ok := ArgumentKind(cmd, len(args))
+	if !ok {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	return completeKind(kind)(cmd, args, toComplete)
+}
+
+func completeKind(kind ResourceKind) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		keys, err := CachedResourceKeys(kind)
+		if err != nil {
+			cobra.CompErrorln(err.Error())
+			return nil, cobra.ShellCompDirectiveError
+		}
+		matches := []string{}
+		for _, k := range keys {
+			if strings.HasPrefix(k, toComplete) {
+				matches = append(matches, k)
+			}
+		}
+		return matches, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// CachedResourceKeys returns the keys of a kind for the current profile and
+// user, reusing keys fetched less than completionCacheTTL ago.
+func CachedResourceKeys(kind ResourceKind) ([]string, error) {
+	asUser, _ := rootCmd.Flags().GetString("as-user")
+	if kind == ResourceAccessLevels || kind == ResourceProfiles {
+		return FetchResourceKeys(nil, asUser, kind)
+	}
+
+	cachePath := filepath.Join(NewDefaultHiarcConfig().GetConfigPath(), completionCacheFileName)
+	cache := map[string]completionCacheEntry{}
+	if data, err := ioutil.ReadFile(cachePath); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	cacheKey := strings.Join([]string{ActiveProfile(), asUser, string(kind)}, "/")
+	if entry, ok := cache[cacheKey]; ok && time.Since(entry.FetchedAt) < completionCacheTTL {
+		return entry.Keys, nil
+	}
+
+	keys, err := FetchResourceKeys(ConfigureHiarcClient(), asUser, kind)
+	if err != nil {
+		return nil, err
+	}
+	for k, entry := range cache {
+		if time.Since(entry.FetchedAt) >= completionCacheTTL {
+			delete(cache, k)
+		}
+	}
+	cache[cacheKey] = completionCacheEntry{Keys: keys, FetchedAt: time.Now()}
+	if data, err := json.Marshal(cache); err == nil && os.MkdirAll(filepath.Dir(cachePath), 0700) == nil {
+		ioutil.WriteFile(cachePath, data, 0600)
+	}
+	return keys, nil
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"strconv"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -30,6 +31,8 @@ type HiarcConfigValues struct {
 	Url         string `json:"url"`
 	AdminKey    string `json:"adminKey"`
 	ProfileName string `json:"profile"`
+	Protected   bool   `json:"protected,omitempty"`
+	Rules       string `json:"rules,omitempty"`
 }
 
 type HiarcConfig struct {
@@ -138,53 +141,42 @@ var configCmd = &cobra.Command{
 var initConfigCmd = &cobra.Command{
 	Use:   "init",
 	Short: "create your config file",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg := NewDefaultHiarcConfig()
 		cfg.AddNewConfig(adminKey, url, profile)
 		for key, value := range cfg.Configs {
 			viper.Set(key, value)
 		}
 		if err := MakeCredentialsFolderIfNotExists(cfg.GetConfigPath()); err != nil {
-			log.Fatal("Something went wrong creating the credentials folder.")
+			return errors.New("Something went wrong creating the credentials folder.")
 		}
 		if err := viper.SafeWriteConfigAs(cfg.GetConfigFilePath()); err != nil {
-			log.Fatal(err)
-		} else {
-			log.Println("Config created")
+			return err
 		}
+		log.Println("Config created")
+		return nil
 	},
 }
 var addConfigCmd = &cobra.Command{
 	Use:   "add [profile name]",
 	Short: "add a new profile to your config file",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Only the new profile's keys are set, so that every setting of the
+		// other profiles is written back as it was read.
 		cfg := NewDefaultHiarcConfig()
-		c := viper.AllSettings()
-		for p := range c {
-			jsonbody, err := json.Marshal(c[p])
-			if err != nil {
-				log.Fatal(err)
-			}
-			config := HiarcConfigValues{}
-			if err := json.Unmarshal(jsonbody, &config); err != nil {
-				log.Fatal(err)
-			}
-			cfg.AddNewConfig(config.AdminKey, config.Url, config.ProfileName)
-		}
-
-		cfg.AddNewConfig(adminKey, url, args[0])
-		for key, value := range cfg.Configs {
-			viper.Set(key, value)
+		viper.Set(fmt.Sprintf("%s.url", args[0]), url)
+		if adminKey != "" {
+			viper.Set(fmt.Sprintf("%s.adminKey", args[0]), adminKey)
 		}
 		if err := MakeCredentialsFolderIfNotExists(cfg.GetConfigPath()); err != nil {
-			log.Fatal("Something went wrong creating the credentials folder.")
+			return errors.New("Something went wrong creating the credentials folder.")
 		}
 		if err := viper.WriteConfig(); err != nil {
-			log.Fatal(err)
-		} else {
-			log.Println("Config profile added.")
+			return err
 		}
+		log.Println("Config profile added.")
+		return nil
 	},
 }
 
@@ -192,24 +184,23 @@ var deleteConfigCmd = &cobra.Command{
 	Use:   "delete [profile name]",
 	Short: "delete a profile from your config file",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		dp := viper.Get(args[0])
 		if dp == nil {
-			log.Fatal("Couldn't find this profile")
-		} else {
-			configMap := viper.AllSettings()
-			delete(configMap, args[0])
-			encodedConfig, _ := json.MarshalIndent(configMap, "", " ")
-			err := viper.ReadConfig(bytes.NewReader(encodedConfig))
-			if err != nil {
-				log.Fatal(err)
-			}
-			if err := viper.WriteConfig(); err != nil {
-				log.Fatal(err)
-			} else {
-				log.Println("Config profile deleted.")
-			}
+			return errors.New("Couldn't find this profile")
+		}
+		configMap := viper.AllSettings()
+		delete(configMap, args[0])
+		encodedConfig, _ := json.MarshalIndent(configMap, "", " ")
+		err := viper.ReadConfig(bytes.NewReader(encodedConfig))
+		if err != nil {
+			return err
 		}
+		if err := viper.WriteConfig(); err != nil {
+			return err
+		}
+		log.Println("Config profile deleted.")
+		return nil
 	},
 }
 
@@ -217,24 +208,25 @@ var viewConfigCmd = &cobra.Command{
 	Use:   "view [profile name]",
 	Short: "view a profile in your config file",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		p := viper.Get(args[0])
 		if p == nil {
-			log.Fatal(fmt.Sprintf("Couldn't find a profile named %s", args[0]))
-		} else {
-			encodedConfig, _ := json.MarshalIndent(p, "", " ")
-			fmt.Println(string(encodedConfig))
+			return fmt.Errorf("Couldn't find a profile named %s", args[0])
 		}
+		encodedConfig, _ := json.MarshalIndent(p, "", " ")
+		fmt.Println(string(encodedConfig))
+		return nil
 	},
 }
 
 var viewAllConfigCmd = &cobra.Command{
 	Use:   "all",
 	Short: "view all of your configs",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		configMap := viper.AllSettings()
 		encodedConfig, _ := json.MarshalIndent(configMap, "", " ")
 		fmt.Println(string(encodedConfig))
+		return nil
 	},
 }
 
@@ -250,38 +242,89 @@ var setUrlConfigCmd = &cobra.Command{
 	Use:   "url [profile name] [new url]",
 	Short: "set a URL in your config file",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		p := viper.Get(args[0])
 		if p == nil {
-			log.Fatal(fmt.Sprintf("Couldn't find a profile named %s", args[0]))
-		} else {
-			url := args[1]
-			viper.Set(fmt.Sprintf("%s.url", args[0]), url)
-			if err := viper.WriteConfig(); err != nil {
-				log.Fatal(err)
-			} else {
-				log.Println(fmt.Sprintf("Url updated on profile %s", args[0]))
-			}
+			return fmt.Errorf("Couldn't find a profile named %s", args[0])
+		}
+		url := args[1]
+		viper.Set(fmt.Sprintf("%s.url", args[0]), url)
+		if err := viper.WriteConfig(); err != nil {
+			return err
 		}
+		log.Println(fmt.Sprintf("Url updated on profile %s", args[0]))
+		return nil
 	},
 }
 var setAdminKeyConfigCmd = &cobra.Command{
 	Use:   "adminKey [profile name] [new key]",
 	Short: "set an admin key in your config file",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		p := viper.Get(args[0])
 		if p == nil {
-			log.Fatal(fmt.Sprintf("Couldn't find a profile named %s", args[0]))
-		} else {
-			adminKey := args[1]
-			viper.Set(fmt.Sprintf("%s.adminKey", args[0]), adminKey)
-			if err := viper.WriteConfig(); err != nil {
-				log.Fatal(err)
-			} else {
-				log.Println(fmt.Sprintf("Admin key updated on profile %s", args[0]))
+			return fmt.Errorf("Couldn't find a profile named %s", args[0])
+		}
+		adminKey := args[1]
+		viper.Set(fmt.Sprintf("%s.adminKey", args[0]), adminKey)
+		if err := viper.WriteConfig(); err != nil {
+			return err
+		}
+		log.Println(fmt.Sprintf("Admin key updated on profile %s", args[0]))
+		return nil
+	},
+}
+
+var setProtectedConfigCmd = &cobra.Command{
+	Use:   "protected [profile name] [true|false]",
+	Short: "refuse destructive commands against a profile",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p := viper.Get(args[0])
+		if p == nil {
+			return fmt.Errorf("Couldn't find a profile named %s", args[0])
+		}
+		protected, err := strconv.ParseBool(args[1])
+		if err != nil {
+			return NewValidationError("Invalid value %s, use true or false", args[1])
+		}
+		viper.Set(fmt.Sprintf("%s.protected", args[0]), protected)
+		if err := viper.WriteConfig(); err != nil {
+			return err
+		}
+		log.Println(fmt.Sprintf("Protected set to %t on profile %s", protected, args[0]))
+		return nil
+	},
+}
+
+var setRulesConfigCmd = &cobra.Command{
+	Use:   "rules [profile name] [rules file]",
+	Short: "set the auto-classification rules file of a profile",
+	Long: `Set the auto-classification rules file of a profile, or pass an empty path
+to stop applying rules. See "hiarc rules --help" for the file format.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p := viper.Get(args[0])
+		if p == nil {
+			return fmt.Errorf("Couldn't find a profile named %s", args[0])
+		}
+		rulesFile := args[1]
+		if rulesFile != "" {
+			abs, err := filepath.Abs(rulesFile)
+			if err != nil {
+				return err
 			}
+			if _, err := LoadRules(abs); err != nil {
+				return err
+			}
+			rulesFile = abs
+		}
+		viper.Set(fmt.Sprintf("%s.rules", args[0]), rulesFile)
+		if err := viper.WriteConfig(); err != nil {
+			return err
 		}
+		log.Println(fmt.Sprintf("Rules file updated on profile %s", args[0]))
+		return nil
 	},
 }
 
@@ -295,6 +338,8 @@ func init() {
 
 	setConfigCmd.AddCommand(setUrlConfigCmd)
 	setConfigCmd.AddCommand(setAdminKeyConfigCmd)
+	setConfigCmd.AddCommand(setProtectedConfigCmd)
+	setConfigCmd.AddCommand(setRulesConfigCmd)
 
 	viewConfigCmd.AddCommand(viewAllConfigCmd)
 
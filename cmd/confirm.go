@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var confirmYes bool
+
+// addConfirmFlag registers --yes on a destructive command.
+func addConfirmFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&confirmYes, "yes", "y", false, "Don't ask for confirmation")
+}
+
+// IsProtectedProfile reports whether profile is marked "protected": true in
+// the config file.
+func IsProtectedProfile(profile string) bool {
+	return viper.GetBool(fmt.Sprintf("%s.protected", profile))
+}
+
+// ConfirmDestructive guards a destructive action. It refuses to run against
+// a protected profile, and otherwise shows the profile and its URL and asks
+// for the profile name to be typed back, unless --yes was passed.
+func ConfirmDestructive(action string) error {
+	profile := ActiveProfile()
+	url := GetConfigUrlByProfile(profile)
+	if IsProtectedProfile(profile) {
+		return &HiarcError{
+			Operation: action,
+			Message:   fmt.Sprintf("profile %s (%s) is protected, run \"hiarc config set protected %s false\" to allow it", profile, url, profile),
+			ExitCode:  ExitForbidden,
+		}
+	}
+	if confirmYes {
+		return nil
+	}
+	if !isTerminal(os.Stdin) {
+		return NewValidationError("%s on profile %s (%s) needs confirmation, pass --yes to run it without a prompt", action, profile, url)
+	}
+
+	fmt.Fprintf(os.Stderr, "You are about to %s on profile %s (%s).\n", action, profile, url)
+	fmt.Fprintf(os.Stderr, "Type the profile name to continue: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return &HiarcError{Operation: action, Message: "aborted, pass --yes to run without a prompt", ExitCode: ExitError}
+	}
+	if strings.TrimSpace(line) != profile {
+		return &HiarcError{Operation: action, Message: "aborted, the profile name didn't match", ExitCode: ExitError}
+	}
+	return nil
+}
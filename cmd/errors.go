@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+)
+
+// Exit codes returned by the CLI so scripts can tell failures apart.
+const (
+	ExitOK         = 0
+	ExitError      = 1
+	ExitNotFound   = 3
+	ExitForbidden  = 4
+	ExitConflict   = 5
+	ExitValidation = 6
+	ExitServer     = 7
+	ExitNetwork    = 8
+	ExitPartial    = 9
+)
+
+const maxErrorBodyLength = 512
+
+// HiarcError describes a failed command, usually a failed call to Hiarc.
+type HiarcError struct {
+	Operation  string `json:"operation,omitempty"`
+	StatusCode int    `json:"status,omitempty"`
+	Message    string `json:"message"`
+	ExitCode   int    `json:"exitCode"`
+	Err        error  `json:"-"`
+}
+
+func (e *HiarcError) Error() string {
+	var parts []string
+	if e.Operation != "" {
+		parts = append(parts, e.Operation)
+	}
+	if e.StatusCode != 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)))
+	}
+	if e.Message != "" {
+		parts = append(parts, e.Message)
+	}
+	return strings.Join(parts, ": ")
+}
+
+func (e *HiarcError) Unwrap() error {
+	return e.Err
+}
+
+// NewAPIError wraps the error returned by a Hiarc SDK call, decoding the
+// response body and choosing an exit code from the HTTP status.
+func NewAPIError(operation string, r *http.Response, err error) *HiarcError {
+	he := &HiarcError{Operation: operation, Err: err}
+	if r == nil {
+		he.ExitCode = ExitNetwork
+		he.Message = err.Error()
+		return he
+	}
+	he.StatusCode = r.StatusCode
+	he.ExitCode = ExitCodeForStatus(r.StatusCode)
+
+	var apiErr hiarc.GenericOpenAPIError
+	if errors.As(err, &apiErr) {
+		he.Message = messageFromBody(apiErr.Body())
+	}
+	if he.Message == "" && r.StatusCode < 300 {
+		// The call succeeded but the response couldn't be decoded.
+		he.Message = err.Error()
+	}
+	return he
+}
+
+// NewValidationError reports input the CLI rejected before calling Hiarc.
+func NewValidationError(format string, a ...interface{}) *HiarcError {
+	return &HiarcError{
+		Message:  fmt.Sprintf(format, a...),
+		ExitCode: ExitValidation,
+	}
+}
+
+// NewPartialFailure reports that failed of the total items of a batch
+// command failed. It exits with ExitPartial, or ExitError when every item
+// failed.
+func NewPartialFailure(failed int, total int, what string) *HiarcError {
+	he := &HiarcError{
+		Message:  fmt.Sprintf("%d of %d %s", failed, total, what),
+		ExitCode: ExitPartial,
+	}
+	if failed == total {
+		he.ExitCode = ExitError
+	}
+	return he
+}
+
+func ExitCodeForStatus(status int) int {
+	switch {
+	case status == http.StatusNotFound:
+		return ExitNotFound
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ExitForbidden
+	case status == http.StatusConflict:
+		return ExitConflict
+	case status == http.StatusBadRequest || status == http.StatusUnprocessableEntity:
+		return ExitValidation
+	case status >= 500:
+		return ExitServer
+	}
+	return ExitError
+}
+
+// ExitCodeFor returns the process exit code for an error returned by a command.
+func ExitCodeFor(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var he *HiarcError
+	if errors.As(err, &he) && he.ExitCode != 0 {
+		return he.ExitCode
+	}
+	return ExitError
+}
+
+// IsNotFound reports whether err is a Hiarc 404.
+func IsNotFound(err error) bool {
+	return ExitCodeFor(err) == ExitNotFound
+}
+
+// IsConflict reports whether err is a Hiarc 409, for example when adding
+// something that already exists.
+func IsConflict(err error) bool {
+	return ExitCodeFor(err) == ExitConflict
+}
+
+// PrintError writes err to stderr, as a JSON document when --output json or
+// jsonl was given explicitly.
+func PrintError(err error) {
+	var he *HiarcError
+	if !errors.As(err, &he) {
+		he = &HiarcError{Message: err.Error(), ExitCode: ExitError}
+	}
+	explicit := rootCmd.PersistentFlags().Changed("output")
+	if explicit && (outputFlag == OutputJSON || outputFlag == OutputJSONLines) {
+		jsonData, jerr := json.Marshal(map[string]*HiarcError{"error": he})
+		if jerr == nil {
+			fmt.Fprintln(os.Stderr, string(jsonData))
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+}
+
+// messageFromBody pulls a readable message out of a Hiarc error response.
+func messageFromBody(body []byte) string {
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		for _, k := range []string{"message", "error", "detail", "title"} {
+			if s, ok := decoded[k].(string); ok && s != "" {
+				return s
+			}
+		}
+		if errs, ok := decoded["errors"]; ok {
+			jsonData, _ := json.Marshal(errs)
+			return string(jsonData)
+		}
+	}
+	msg := strings.TrimSpace(string(body))
+	if len(msg) > maxErrorBodyLength {
+		msg = msg[:maxErrorBodyLength] + "..."
+	}
+	return msg
+}
@@ -2,9 +2,8 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -25,6 +24,7 @@ var (
 	fileStorageId       string
 	filePathUpload      string
 	filePathDownload    string
+	fileDirect          bool
 	directUploadExpires int32
 	fileQueries         []string
 )
@@ -39,7 +39,7 @@ var getFileCmd = &cobra.Command{
 	Use:   "get [file key]",
 	Short: "Get file by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.GetFileOpts{}
@@ -49,11 +49,9 @@ var getFileCmd = &cobra.Command{
 
 		file, r, err := hiarcClient.FileApi.GetFile(context.Background(), args[0], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.GetFile``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("FileApi.GetFile", r, err)
 		}
-		jsonData, err := json.MarshalIndent(file, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(file)
 	},
 }
 
@@ -61,9 +59,9 @@ var getFileVersionsCmd = &cobra.Command{
 	Use:   "versions",
 	Short: "Get versions of file by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			log.Fatal("Needs file key as argument")
+			return errors.New("Needs file key as argument")
 		}
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
@@ -74,11 +72,9 @@ var getFileVersionsCmd = &cobra.Command{
 
 		versions, r, err := hiarcClient.FileApi.GetVersions(context.Background(), args[0], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.GetVersions``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("FileApi.GetVersions", r, err)
 		}
-		jsonData, err := json.MarshalIndent(versions, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(versions)
 	},
 }
 
@@ -86,9 +82,9 @@ var getFileRetentionPoliciesCmd = &cobra.Command{
 	Use:   "retention-policies",
 	Short: "Get retention policies for file by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			log.Fatal("Needs file key as argument")
+			return errors.New("Needs file key as argument")
 		}
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
@@ -99,11 +95,9 @@ var getFileRetentionPoliciesCmd = &cobra.Command{
 
 		policies, r, err := hiarcClient.FileApi.GetRetentionPolicies(context.Background(), args[0], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.GetRetentionPolicies``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("FileApi.GetRetentionPolicies", r, err)
 		}
-		jsonData, err := json.MarshalIndent(policies, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(policies)
 	},
 }
 
@@ -111,9 +105,9 @@ var getFileCollectionsCmd = &cobra.Command{
 	Use:   "collections",
 	Short: "Get collections for file by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			log.Fatal("Needs file key as argument")
+			return errors.New("Needs file key as argument")
 		}
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
@@ -124,11 +118,9 @@ var getFileCollectionsCmd = &cobra.Command{
 
 		collections, r, err := hiarcClient.FileApi.GetCollectionsForFile(context.Background(), args[0], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.GetCollectionsForFile``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("FileApi.GetCollectionsForFile", r, err)
 		}
-		jsonData, err := json.MarshalIndent(collections, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(collections)
 	},
 }
 
@@ -136,7 +128,7 @@ var getDirectDownloadCmd = &cobra.Command{
 	Use:   "direct-download [file key]",
 	Short: "Get direct download for file",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.GetDirectDownloadUrlOpts{}
@@ -146,18 +138,16 @@ var getDirectDownloadCmd = &cobra.Command{
 
 		url, r, err := hiarcClient.FileApi.GetDirectDownloadUrl(context.Background(), args[0], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.GetRetentionPolicies``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("FileApi.GetDirectDownloadUrl", r, err)
 		}
-		jsonData, err := json.MarshalIndent(url, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(url)
 	},
 }
 
 var getDirectUploadCmd = &cobra.Command{
 	Use:   "direct-upload",
 	Short: "Get direct upload for file",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.CreateDirectUploadUrlOpts{}
@@ -175,31 +165,28 @@ var getDirectUploadCmd = &cobra.Command{
 
 		url, r, err := hiarcClient.FileApi.CreateDirectUploadUrl(context.Background(), du, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.CreateDirectUploadUrl``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("FileApi.CreateDirectUploadUrl", r, err)
 		}
-		jsonData, err := json.MarshalIndent(url, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(url)
 	},
 }
 
 var createFileCmd = &cobra.Command{
 	Use:   "create [file key]",
 	Short: "Upload a file with key and other file attributes",
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `Upload a file with key and other file attributes. The auto-classification
+rules of the profile, if any, add classifications, retention policies and
+metadata defaults to the new file; see "hiarc rules --help".`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
-		asUser, err := rootCmd.Flags().GetString("as-user")
-		opts := hiarc.CreateFileOpts{}
-		if asUser != "" && err == nil {
-			opts.XHiarcUserKey = optional.NewString(asUser)
-		}
+		asUser, _ := rootCmd.Flags().GetString("as-user")
 
 		cf := hiarc.CreateFileRequest{Key: args[0]}
 		if fileMetadata != "" {
 			md, err := ConvertMetadataStringToObject(fileMetadata)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			cf.Metadata = md
 		}
@@ -208,7 +195,7 @@ var createFileCmd = &cobra.Command{
 		} else {
 			fi, err := os.Stat(filePathUpload)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			fileName = fi.Name()
 			cf.Name = fi.Name()
@@ -220,21 +207,86 @@ var createFileCmd = &cobra.Command{
 			cf.StorageService = fileStorageService
 		}
 
-		file, r, err := hiarcClient.FileApi.CreateFile(context.Background(), filePathUpload, fileName, cf, &opts)
+		rules, err := ProfileRules()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.CreateFile``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return err
 		}
-		jsonData, err := json.MarshalIndent(file, "", "    ")
-		fmt.Println(string(jsonData))
+		applied, err := rules.Evaluate(RuleInput{Path: filePathUpload, Name: cf.Name, Metadata: cf.Metadata})
+		if err != nil {
+			return err
+		}
+		cf.Metadata = applied.WithMetadata(cf.Metadata)
+
+		var file hiarc.File
+		if fileDirect {
+			file, err = createFileDirect(hiarcClient, asUser, cf)
+		} else {
+			file, err = NewTransfer(hiarcClient, asUser).CreateFile(filePathUpload, cf)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied.Classifications) == 0 && len(applied.RetentionPolicies) == 0 {
+			return PrintResult(file)
+		}
+		if err := applyRules(hiarcClient, asUser, file.Key, applied); err != nil {
+			return err
+		}
+		opts := hiarc.GetFileOpts{}
+		if asUser != "" {
+			opts.XHiarcUserKey = optional.NewString(asUser)
+		}
+		file, r, err := hiarcClient.FileApi.GetFile(context.Background(), file.Key, &opts)
+		if err != nil {
+			return NewAPIError("FileApi.GetFile", r, err)
+		}
+		return PrintResult(file)
 	},
 }
 
+// createFileDirect uploads a new file through a presigned URL. Attaching
+// doesn't take a description or metadata, so they are set afterwards.
+func createFileDirect(hiarcClient *hiarc.APIClient, asUser string, cf hiarc.CreateFileRequest) (hiarc.File, error) {
+	getOpts := hiarc.GetFileOpts{}
+	if asUser != "" {
+		getOpts.XHiarcUserKey = optional.NewString(asUser)
+	}
+	if _, _, err := hiarcClient.FileApi.GetFile(context.Background(), cf.Key, &getOpts); err == nil {
+		return hiarc.File{}, &HiarcError{
+			Operation: "FileApi.AttachToExisitingFile",
+			Message:   fmt.Sprintf("File %s already exists, use add-version to upload a new version", cf.Key),
+			ExitCode:  ExitConflict,
+		}
+	}
+
+	file, err := NewTransfer(hiarcClient, asUser).DirectUpload(cf.Key, filePathUpload, cf.Name, cf.StorageService)
+	if err != nil || (cf.Description == "" && cf.Metadata == nil) {
+		return file, err
+	}
+	md := map[string]interface{}{}
+	for k, v := range file.Metadata {
+		md[k] = v
+	}
+	for k, v := range cf.Metadata {
+		md[k] = v
+	}
+	opts := hiarc.UpdateFileOpts{}
+	if asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(asUser)
+	}
+	uf := hiarc.UpdateFileRequest{Description: cf.Description, Metadata: md}
+	file, r, err := hiarcClient.FileApi.UpdateFile(context.Background(), cf.Key, uf, &opts)
+	if err != nil {
+		return file, NewAPIError("FileApi.UpdateFile", r, err)
+	}
+	return file, nil
+}
+
 var attachFileCmd = &cobra.Command{
 	Use:   "attach [file key]",
 	Short: "Attach to an existing file in a storage service",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.AttachToExisitingFileOpts{}
@@ -255,11 +307,9 @@ var attachFileCmd = &cobra.Command{
 
 		file, r, err := hiarcClient.FileApi.AttachToExisitingFile(context.Background(), args[0], ar, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.AttachToExisitingFIle``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("FileApi.AttachToExisitingFile", r, err)
 		}
-		jsonData, err := json.MarshalIndent(file, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(file)
 	},
 }
 
@@ -267,7 +317,7 @@ var copyFileCmd = &cobra.Command{
 	Use:   "copy [source file key] [destination file key]",
 	Short: "Attach to an existing file in a storage service",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.CopyFileOpts{}
@@ -282,11 +332,9 @@ var copyFileCmd = &cobra.Command{
 
 		file, r, err := hiarcClient.FileApi.CopyFile(context.Background(), args[0], cr, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.CopyFile``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("FileApi.CopyFile", r, err)
 		}
-		jsonData, err := json.MarshalIndent(file, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(file)
 	},
 }
 
@@ -294,13 +342,9 @@ var addVersionCmd = &cobra.Command{
 	Use:   "add-version [file key]",
 	Short: "Upload a new version of a file",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
-		asUser, err := rootCmd.Flags().GetString("as-user")
-		opts := hiarc.AddVersionOpts{}
-		if asUser != "" && err == nil {
-			opts.XHiarcUserKey = optional.NewString(asUser)
-		}
+		asUser, _ := rootCmd.Flags().GetString("as-user")
 
 		av := hiarc.AddVersionToFileRequest{Key: args[0]}
 		if fileStorageService != "" {
@@ -309,18 +353,23 @@ var addVersionCmd = &cobra.Command{
 		if fileName == "" {
 			fi, err := os.Stat(filePathUpload)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			fileName = fi.Name()
 		}
 
-		file, r, err := hiarcClient.FileApi.AddVersion(context.Background(), args[0], filePathUpload, fileName, av, &opts)
+		t := NewTransfer(hiarcClient, asUser)
+		var file hiarc.File
+		var err error
+		if fileDirect {
+			file, err = t.DirectUpload(args[0], filePathUpload, fileName, fileStorageService)
+		} else {
+			file, err = t.AddVersion(args[0], filePathUpload, fileName, av)
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.AddVersion``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return err
 		}
-		jsonData, err := json.MarshalIndent(file, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(file)
 	},
 }
 
@@ -328,11 +377,10 @@ var addGroupToFileCmd = &cobra.Command{
 	Use:   "add-group [file key] [group key] [access level]",
 	Short: "Grant access to a file for a group",
 	Args:  cobra.ExactArgs(3),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		accessLevel := strings.ToUpper(args[2])
 		if !IsValidAccessLevel(accessLevel) {
-			log.Println(fmt.Sprintf("%s is not a valid access level", accessLevel))
-			log.Fatal(fmt.Sprintf("Choose from the following: %s, %s, %s, or %s", string(hiarc.CO_OWNER), string(hiarc.READ_WRITE), string(hiarc.READ_ONLY), string(hiarc.UPLOAD_ONLY)))
+			return NewValidationError("%s is not a valid access level. Choose from the following: %s, %s, %s, or %s", accessLevel, string(hiarc.CO_OWNER), string(hiarc.READ_WRITE), string(hiarc.READ_ONLY), string(hiarc.UPLOAD_ONLY))
 		}
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
@@ -342,17 +390,15 @@ var addGroupToFileCmd = &cobra.Command{
 		}
 		al, err := GetAccessLevelFromString(accessLevel)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		ag := hiarc.AddGroupToFileRequest{GroupKey: args[1], AccessLevel: al}
 
 		file, r, err := hiarcClient.FileApi.AddGroupToFile(context.Background(), args[0], ag, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.AddGroupToFile``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("FileApi.AddGroupToFile", r, err)
 		}
-		jsonData, err := json.MarshalIndent(file, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(file)
 	},
 }
 
@@ -360,11 +406,10 @@ var addUserToFileCmd = &cobra.Command{
 	Use:   "add-user [file key] [user key] [access level]",
 	Short: "Grant access to a file for a user",
 	Args:  cobra.ExactArgs(3),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		accessLevel := strings.ToUpper(args[2])
 		if !IsValidAccessLevel(accessLevel) {
-			log.Println(fmt.Sprintf("%s is not a valid access level", accessLevel))
-			log.Fatal(fmt.Sprintf("Choose from the following: %s, %s, %s, or %s", string(hiarc.CO_OWNER), string(hiarc.READ_WRITE), string(hiarc.READ_ONLY), string(hiarc.UPLOAD_ONLY)))
+			return NewValidationError("%s is not a valid access level. Choose from the following: %s, %s, %s, or %s", accessLevel, string(hiarc.CO_OWNER), string(hiarc.READ_WRITE), string(hiarc.READ_ONLY), string(hiarc.UPLOAD_ONLY))
 		}
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
@@ -374,17 +419,15 @@ var addUserToFileCmd = &cobra.Command{
 		}
 		al, err := GetAccessLevelFromString(accessLevel)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		au := hiarc.AddUserToFileRequest{UserKey: args[1], AccessLevel: al}
 
 		file, r, err := hiarcClient.FileApi.AddUserToFile(context.Background(), args[0], au, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.AddUserToFile``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("FileApi.AddUserToFile", r, err)
 		}
-		jsonData, err := json.MarshalIndent(file, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(file)
 	},
 }
 
@@ -392,7 +435,7 @@ var addClassificationToFileCmd = &cobra.Command{
 	Use:   "add-classification [file key] [classification key]",
 	Short: "Add classification to a file",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.AddClassificationToFileOpts{}
@@ -403,11 +446,9 @@ var addClassificationToFileCmd = &cobra.Command{
 
 		file, r, err := hiarcClient.FileApi.AddClassificationToFile(context.Background(), args[0], ac, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.AddClassificationToFile``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("FileApi.AddClassificationToFile", r, err)
 		}
-		jsonData, err := json.MarshalIndent(file, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(file)
 	},
 }
 
@@ -415,7 +456,7 @@ var addRetentionPolicyToFileCmd = &cobra.Command{
 	Use:   "add-retention [file key] [retention policy key]",
 	Short: "Add a retention policy to a file",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.AddRetentionPolicyToFileOpts{}
@@ -426,11 +467,9 @@ var addRetentionPolicyToFileCmd = &cobra.Command{
 
 		file, r, err := hiarcClient.FileApi.AddRetentionPolicyToFile(context.Background(), args[0], ar, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.AddRetentionPolicyToFile``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("FileApi.AddRetentionPolicyToFile", r, err)
 		}
-		jsonData, err := json.MarshalIndent(file, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(file)
 	},
 }
 
@@ -438,56 +477,56 @@ var downloadFileCmd = &cobra.Command{
 	Use:   "download [file key]",
 	Short: "Download a file to your local system",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
-		opts := hiarc.DownloadFileOpts{}
-		if asUser != "" && err == nil {
-			opts.XHiarcUserKey = optional.NewString(asUser)
-		}
 		getOpts := hiarc.GetFileOpts{}
 		if asUser != "" && err == nil {
-			opts.XHiarcUserKey = optional.NewString(asUser)
+			getOpts.XHiarcUserKey = optional.NewString(asUser)
 		}
 		s, err := os.Stat(filePathDownload)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		if s.IsDir() != true {
-			log.Fatal("Download path must be a directory.")
+			return NewValidationError("Download path must be a directory.")
 		}
 		if fileName == "" {
 			f, r, err := hiarcClient.FileApi.GetFile(context.Background(), args[0], &getOpts)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error when calling `FileApi.GetFile``: %v\n", err)
-				fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+				return NewAPIError("FileApi.GetFile", r, err)
 			}
 			fileName = f.Name
 		}
 
-		fib, r, err := hiarcClient.FileApi.DownloadFile(context.Background(), args[0], &opts)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.DownloadFile``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
-		}
-
-		out, err := os.Create(filepath.Join(filePathDownload, fileName))
-		if err != nil {
-			log.Fatal(err)
+		t := NewTransfer(hiarcClient, asUser)
+		dest := filepath.Join(filePathDownload, fileName)
+		if fileDirect {
+			err = t.DirectDownload(args[0], dest)
+		} else {
+			err = t.Download(args[0], dest)
 		}
-		_, err = io.Copy(out, fib)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		log.Println(fmt.Sprintf("Downloaded file: %s to the following location: %s", args[0], filePathDownload))
+		return nil
 	},
 }
 
+// DownloadFileToPath downloads the latest version of a file to dest without
+// showing progress, for commands that download many files at once.
+func DownloadFileToPath(hiarcClient *hiarc.APIClient, key string, asUser string, dest string) error {
+	t := NewTransfer(hiarcClient, asUser)
+	t.Progress = false
+	return t.Download(key, dest)
+}
+
 var updateFileCmd = &cobra.Command{
 	Use:   "update [file key]",
 	Short: "Update a file",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.UpdateFileOpts{}
@@ -499,7 +538,7 @@ var updateFileCmd = &cobra.Command{
 		if fileMetadata != "" {
 			md, err := ConvertMetadataStringToObject(fileMetadata)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			uf.Metadata = md
 		}
@@ -512,11 +551,9 @@ var updateFileCmd = &cobra.Command{
 
 		file, r, err := hiarcClient.FileApi.UpdateFile(context.Background(), args[0], uf, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.UpdateFile``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("FileApi.UpdateFile", r, err)
 		}
-		jsonData, err := json.MarshalIndent(file, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(file)
 	},
 }
 
@@ -524,7 +561,7 @@ var filterFilesCmd = &cobra.Command{
 	Use:   "filter [list of file keys]",
 	Short: "Filter which files a user can access",
 	Args:  cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.FilterAllowedFilesOpts{}
@@ -536,21 +573,27 @@ var filterFilesCmd = &cobra.Command{
 
 		file, r, err := hiarcClient.FilesApi.FilterAllowedFiles(context.Background(), fr, &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.FilterAllowedFiles``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("FilesApi.FilterAllowedFiles", r, err)
 		}
-		jsonData, err := json.MarshalIndent(file, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(file)
 	},
 }
 
 var deleteFileCmd = &cobra.Command{
 	Use:   "delete [file key]",
 	Short: "Delete file by key",
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `Delete a file by key. Files with a retention policy that hasn't expired
+are refused before anything is deleted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
+		if err := checkFileDeletable(hiarcClient, asUser, args[0]); err != nil {
+			return err
+		}
+		if err := ConfirmDestructive(fmt.Sprintf("delete file %s", args[0])); err != nil {
+			return err
+		}
 		opts := hiarc.DeleteFileOpts{}
 		if asUser != "" && err == nil {
 			opts.XHiarcUserKey = optional.NewString(asUser)
@@ -558,11 +601,10 @@ var deleteFileCmd = &cobra.Command{
 
 		_, r, err := hiarcClient.FileApi.DeleteFile(context.Background(), args[0], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `FileApi.DeleteFile``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
-		} else {
-			log.Println(fmt.Sprintf("Deleted file: %s", args[0]))
+			return NewAPIError("FileApi.DeleteFile", r, err)
 		}
+		log.Println(fmt.Sprintf("Deleted file: %s", args[0]))
+		return nil
 	},
 }
 
@@ -575,6 +617,7 @@ func init() {
 	fileCmd.AddCommand(updateFileCmd)
 	fileCmd.AddCommand(downloadFileCmd)
 	fileCmd.AddCommand(deleteFileCmd)
+	addConfirmFlag(deleteFileCmd)
 	fileCmd.AddCommand(addVersionCmd)
 	fileCmd.AddCommand(addUserToFileCmd)
 	fileCmd.AddCommand(addGroupToFileCmd)
@@ -595,6 +638,8 @@ func init() {
 	createFileCmd.Flags().StringVar(&fileStorageService, "storage-service", "", "Service used to store file")
 	createFileCmd.Flags().StringVar(&filePathUpload, "path", "", "Local file path to upload (required)")
 	createFileCmd.MarkFlagRequired("path")
+	createFileCmd.Flags().IntVar(&transferRetries, "retries", defaultRetries, transferRetriesUse)
+	createFileCmd.Flags().BoolVar(&fileDirect, "direct", false, "Transfer the file straight to or from the storage service through a presigned URL")
 
 	attachFileCmd.Flags().StringVar(&fileName, "name", "", "File name")
 	attachFileCmd.Flags().StringVar(&fileStorageService, "storage-service", "", "Service used to store file")
@@ -610,6 +655,8 @@ func init() {
 	addVersionCmd.Flags().StringVar(&fileStorageService, "storage-service", "", "Service used to store file")
 	addVersionCmd.Flags().StringVar(&filePathUpload, "path", "", "Local file path to upload (required)")
 	addVersionCmd.MarkFlagRequired("path")
+	addVersionCmd.Flags().IntVar(&transferRetries, "retries", defaultRetries, transferRetriesUse)
+	addVersionCmd.Flags().BoolVar(&fileDirect, "direct", false, "Transfer the file straight to or from the storage service through a presigned URL")
 
 	getDirectUploadCmd.Flags().StringVar(&fileStorageService, "storage-service", "", "Service used to store file")
 	getDirectUploadCmd.Flags().Int32Var(&directUploadExpires, "expires-in", 0, "When upload link expires in seconds")
@@ -617,4 +664,6 @@ func init() {
 	downloadFileCmd.Flags().StringVar(&fileName, "name", "", "Change file name on local system when downloading")
 	downloadFileCmd.Flags().StringVar(&filePathDownload, "path", "", "Local file path to download (required)")
 	downloadFileCmd.MarkFlagRequired("path")
+	downloadFileCmd.Flags().IntVar(&transferRetries, "retries", defaultRetries, transferRetriesUse)
+	downloadFileCmd.Flags().BoolVar(&fileDirect, "direct", false, "Transfer the file straight to or from the storage service through a presigned URL")
 }
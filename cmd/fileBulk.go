@@ -0,0 +1,331 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/antihax/optional"
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"github.com/spf13/cobra"
+)
+
+const (
+	BulkStatusOK     = "ok"
+	BulkStatusFailed = "failed"
+)
+
+const bulkLong = `Keys come from a file with one key per line given with --keys-from, where
+- reads standard input and blank lines and lines starting with # are
+skipped, or from the files of a collection given with --collection, and
+with --recursive of the collections below it. --query and --where match the
+files the same way file find does, in every collection unless --collection
+is passed.
+
+The action runs on --concurrency files at a time and carries on past
+failures. A JSON line with the key, action, status and error is written for
+each file as it finishes, followed by a summary of the counts. The command
+exits with 9 when some files failed, and 1 when they all did.`
+
+var (
+	bulkKeysFrom    string
+	bulkCollection  string
+	bulkRecursive   bool
+	bulkQueries     []string
+	bulkWhere       string
+	bulkConcurrency int
+
+	bulkName        string
+	bulkDescription string
+	bulkMetadata    string
+)
+
+// BulkResult is what a bulk action did with one file.
+type BulkResult struct {
+	Key    string `json:"key"`
+	Action string `json:"action"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+var bulkFileCmd = &cobra.Command{
+	Use:   "bulk",
+	Short: "Run a file command on many files",
+	Long:  bulkLong,
+	Run:   nil,
+}
+
+var bulkAddUserCmd = &cobra.Command{
+	Use:   "add-user [user key] [access level]",
+	Short: "Grant a user access to many files",
+	Long:  "Grant a user access to many files.\n\n" + bulkLong,
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		al, err := parseAccessLevel(args[1])
+		if err != nil {
+			return err
+		}
+		return runBulk("add-user", func(client *hiarc.APIClient, asUser string, key string) error {
+			return grantAccess(client, asUser, AccessOnFile, key, GranteeUser, args[0], al)
+		})
+	},
+}
+
+var bulkAddGroupCmd = &cobra.Command{
+	Use:   "add-group [group key] [access level]",
+	Short: "Grant a group access to many files",
+	Long:  "Grant a group access to many files.\n\n" + bulkLong,
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		al, err := parseAccessLevel(args[1])
+		if err != nil {
+			return err
+		}
+		return runBulk("add-group", func(client *hiarc.APIClient, asUser string, key string) error {
+			return grantAccess(client, asUser, AccessOnFile, key, GranteeGroup, args[0], al)
+		})
+	},
+}
+
+var bulkAddRetentionCmd = &cobra.Command{
+	Use:   "add-retention [retention policy key]",
+	Short: "Add a retention policy to many files",
+	Long:  "Add a retention policy to many files.\n\n" + bulkLong,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBulk("add-retention", func(client *hiarc.APIClient, asUser string, key string) error {
+			opts := hiarc.AddRetentionPolicyToFileOpts{}
+			if asUser != "" {
+				opts.XHiarcUserKey = optional.NewString(asUser)
+			}
+			ar := hiarc.AddRetentionPolicyToFileRequest{RetentionPolicyKey: args[0]}
+			if _, r, err := client.FileApi.AddRetentionPolicyToFile(context.Background(), key, ar, &opts); err != nil {
+				return NewAPIError("FileApi.AddRetentionPolicyToFile", r, err)
+			}
+			return nil
+		})
+	},
+}
+
+var bulkUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update many files",
+	Long: `Set the name or description of many files, or merge --metadata into their
+metadata, keeping the properties it doesn't set.
+
+` + bulkLong,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if bulkName == "" && bulkDescription == "" && bulkMetadata == "" {
+			return NewValidationError("Pass --name, --description or --metadata to update")
+		}
+		var md map[string]interface{}
+		if bulkMetadata != "" {
+			m, err := ConvertMetadataStringToObject(bulkMetadata)
+			if err != nil {
+				return err
+			}
+			md = m
+		}
+		return runBulk("update", func(client *hiarc.APIClient, asUser string, key string) error {
+			uf := hiarc.UpdateFileRequest{Name: bulkName, Description: bulkDescription}
+			if md != nil {
+				getOpts := hiarc.GetFileOpts{}
+				if asUser != "" {
+					getOpts.XHiarcUserKey = optional.NewString(asUser)
+				}
+				file, r, err := client.FileApi.GetFile(context.Background(), key, &getOpts)
+				if err != nil {
+					return NewAPIError("FileApi.GetFile", r, err)
+				}
+				uf.Metadata = map[string]interface{}{}
+				for k, v := range file.Metadata {
+					uf.Metadata[k] = v
+				}
+				for k, v := range md {
+					uf.Metadata[k] = v
+				}
+			}
+			opts := hiarc.UpdateFileOpts{}
+			if asUser != "" {
+				opts.XHiarcUserKey = optional.NewString(asUser)
+			}
+			if _, r, err := client.FileApi.UpdateFile(context.Background(), key, uf, &opts); err != nil {
+				return NewAPIError("FileApi.UpdateFile", r, err)
+			}
+			return nil
+		})
+	},
+}
+
+var bulkDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete many files",
+	Long: `Delete many files. Files with a retention policy that hasn't expired are
+refused and reported as failed.
+
+` + bulkLong,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBulk("delete", func(client *hiarc.APIClient, asUser string, key string) error {
+			if err := checkFileDeletable(client, asUser, key); err != nil {
+				return err
+			}
+			opts := hiarc.DeleteFileOpts{}
+			if asUser != "" {
+				opts.XHiarcUserKey = optional.NewString(asUser)
+			}
+			if _, r, err := client.FileApi.DeleteFile(context.Background(), key, &opts); err != nil {
+				return NewAPIError("FileApi.DeleteFile", r, err)
+			}
+			return nil
+		})
+	},
+}
+
+// runBulk selects the files from the bulk flags and runs fn on each of them
+// on a pool of workers.
+func runBulk(action string, fn func(client *hiarc.APIClient, asUser string, key string) error) error {
+	selector := bulkCollection != "" || bulkWhere != "" || len(bulkQueries) > 0
+	if (bulkKeysFrom != "") == selector {
+		return NewValidationError("Pass either --keys-from, or --collection, --query or --where to choose the files")
+	}
+	if bulkRecursive && bulkCollection == "" {
+		return NewValidationError("--recursive needs --collection")
+	}
+	if bulkConcurrency < 1 {
+		return NewValidationError("--concurrency must be at least 1")
+	}
+	if action == "delete" && bulkKeysFrom == "-" && !confirmYes {
+		return NewValidationError("--keys-from - reads the keys from standard input, which leaves no way to confirm, pass --yes to delete them")
+	}
+
+	hiarcClient := ConfigureHiarcClient()
+	asUser, _ := rootCmd.Flags().GetString("as-user")
+	keys, err := bulkKeys(hiarcClient, asUser)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		log.Println("No files to " + action)
+		return nil
+	}
+	if action == "delete" {
+		if err := ConfirmDestructive(fmt.Sprintf("delete %d files", len(keys))); err != nil {
+			return err
+		}
+	}
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	for w := 0; w < bulkConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range queue {
+				result := BulkResult{Key: key, Action: action, Status: BulkStatusOK}
+				if err := fn(hiarcClient, asUser, key); err != nil {
+					result.Status = BulkStatusFailed
+					result.Error = err.Error()
+				}
+				jsonData, _ := json.Marshal(result)
+
+				mu.Lock()
+				if result.Status == BulkStatusFailed {
+					failed++
+				}
+				fmt.Println(string(jsonData))
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, key := range keys {
+		queue <- key
+	}
+	close(queue)
+	wg.Wait()
+
+	log.Println(fmt.Sprintf("%s: %d files, %d ok, %d failed", action, len(keys), len(keys)-failed, failed))
+	if failed == 0 {
+		return nil
+	}
+	return NewPartialFailure(failed, len(keys), "files failed")
+}
+
+// bulkKeys returns the keys read from --keys-from, or those of the files
+// matching the selector flags, without duplicates.
+func bulkKeys(client *hiarc.APIClient, asUser string) ([]string, error) {
+	if bulkKeysFrom != "" {
+		var in io.Reader = os.Stdin
+		if bulkKeysFrom != "-" {
+			f, err := os.Open(bulkKeysFrom)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			in = f
+		}
+		return readKeys(in)
+	}
+
+	selector, err := NewFileSelector(client, asUser, bulkCollection, bulkRecursive, bulkQueries, bulkWhere)
+	if err != nil {
+		return nil, err
+	}
+	files, err := selector.All()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(files))
+	for i, f := range files {
+		keys[i] = f.Key
+	}
+	return keys, nil
+}
+
+// readKeys reads one key per line, skipping blank lines, comments and
+// duplicates.
+func readKeys(in io.Reader) ([]string, error) {
+	keys := []string{}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		key := strings.TrimSpace(scanner.Text())
+		if key == "" || strings.HasPrefix(key, "#") || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	return keys, scanner.Err()
+}
+
+func addBulkFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&bulkKeysFrom, "keys-from", "", "File with one file key per line, or - for standard input")
+	cmd.Flags().StringVar(&bulkCollection, "collection", "", "Run on the files in this collection")
+	cmd.Flags().BoolVar(&bulkRecursive, "recursive", false, "Also run on the files in the collections below --collection")
+	cmd.Flags().StringArrayVar(&bulkQueries, "query", make([]string, 0), "File query")
+	cmd.Flags().StringVar(&bulkWhere, "where", "", whereUse)
+	cmd.Flags().IntVar(&bulkConcurrency, "concurrency", 4, "Number of files to run on at the same time")
+}
+
+func init() {
+	fileCmd.AddCommand(bulkFileCmd)
+	for _, c := range []*cobra.Command{bulkAddUserCmd, bulkAddGroupCmd, bulkAddRetentionCmd, bulkUpdateCmd, bulkDeleteCmd} {
+		bulkFileCmd.AddCommand(c)
+		addBulkFlags(c)
+	}
+	addConfirmFlag(bulkDeleteCmd)
+
+	bulkUpdateCmd.Flags().StringVar(&bulkName, "name", "", "New name of the files")
+	bulkUpdateCmd.Flags().StringVar(&bulkDescription, "description", "", "New description of the files")
+	bulkUpdateCmd.Flags().StringVar(&bulkMetadata, "metadata", "", "Metadata to merge into the metadata of the files")
+}
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/antihax/optional"
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fileFindCollection      string
+	fileFindRetentionPolicy string
+)
+
+var findFileCmd = &cobra.Command{
+	Use:   "find",
+	Short: "Find files by query",
+	Long: `Find files whose properties and metadata match a query. Hiarc has no
+endpoint to search files, so the files of every collection, or of the
+collection subtree given with --collection, are listed and matched on the
+client. Files that aren't in any collection are never found.
+
+Properties are key, name, description, createdBy, createdAt, modifiedAt,
+versionCount and the metadata properties, which can also be written as
+metadata.<name>. Without a query every file passing the other filters
+matches.
+
+Files can't be found by classification: Hiarc has no API to read the
+classifications of a file.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hiarcClient := ConfigureHiarcClient()
+		asUser, _ := rootCmd.Flags().GetString("as-user")
+		selector, err := NewFileSelector(hiarcClient, asUser, fileFindCollection, true, fileQueries, whereFlag)
+		if err != nil {
+			return err
+		}
+		selector.RetentionPolicy = fileFindRetentionPolicy
+
+		// Files are matched a collection at a time, so results are printed
+		// while the rest is still being walked.
+		it := NewFuncIterator(func() ([]interface{}, error) {
+			files, _, err := selector.Next()
+			if err != nil {
+				return nil, err
+			}
+			found := make([]interface{}, len(files))
+			for i, f := range files {
+				found[i] = f
+			}
+			return found, nil
+		})
+		return PrintList(cmd, it)
+	},
+}
+
+// FileSelector walks the files chosen by the --collection, --query and
+// --where flags shared by file find, file bulk and classification apply.
+type FileSelector struct {
+	// RetentionPolicy, when set, only keeps the files with this policy.
+	RetentionPolicy string
+
+	client *hiarc.APIClient
+	asUser string
+	walker *FileWalker
+	query  []map[string]interface{}
+}
+
+// NewFileSelector selects the files in collection, and with recursive in the
+// collections below it, or in every collection when collection is empty,
+// matching the query given by queries or where, if any.
+func NewFileSelector(client *hiarc.APIClient, asUser string, collection string, recursive bool, queries []string, where string) (*FileSelector, error) {
+	s := &FileSelector{client: client, asUser: asUser}
+	if where != "" || len(queries) > 0 {
+		q, err := FindQuery(queries, where)
+		if err != nil {
+			return nil, err
+		}
+		s.query = q
+	}
+	if collection != "" {
+		s.walker = NewFileWalker(client, asUser, []string{collection}, recursive)
+	} else {
+		w, err := NewAllFilesWalker(client, asUser)
+		if err != nil {
+			return nil, err
+		}
+		s.walker = w
+	}
+	return s, nil
+}
+
+// Next returns the matching files of the next collections walked, and false
+// once every collection has been walked.
+func (s *FileSelector) Next() ([]hiarc.File, bool, error) {
+	for {
+		files, more, err := s.walker.Next()
+		if err != nil || !more {
+			return nil, false, err
+		}
+		var found []hiarc.File
+		for _, f := range files {
+			ok, err := s.match(f)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				found = append(found, f)
+			}
+		}
+		if len(found) > 0 {
+			return found, true, nil
+		}
+	}
+}
+
+// All returns every matching file sorted by key.
+func (s *FileSelector) All() ([]hiarc.File, error) {
+	all := []hiarc.File{}
+	for {
+		files, more, err := s.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+		all = append(all, files...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Key < all[j].Key })
+	return all, nil
+}
+
+// match applies the query and the retention policy filter to a file,
+// cheapest first.
+func (s *FileSelector) match(f hiarc.File) (bool, error) {
+	if s.query != nil {
+		props, err := fileProps(f)
+		if err != nil {
+			return false, err
+		}
+		ok, err := MatchQuery(s.query, props)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	if s.RetentionPolicy != "" {
+		opts := hiarc.GetRetentionPoliciesOpts{}
+		if s.asUser != "" {
+			opts.XHiarcUserKey = optional.NewString(s.asUser)
+		}
+		policies, r, err := s.client.FileApi.GetRetentionPolicies(context.Background(), f.Key, &opts)
+		if err != nil {
+			return false, NewAPIError("FileApi.GetRetentionPolicies", r, err)
+		}
+		for _, p := range policies {
+			if p.RetentionPolicy.Key == s.RetentionPolicy {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// fileProps turns a file into the properties a query is matched against,
+// with the metadata properties next to the file's own.
+func fileProps(f hiarc.File) (map[string]interface{}, error) {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	props := map[string]interface{}{}
+	if err := json.Unmarshal(data, &props); err != nil {
+		return nil, err
+	}
+	for k, v := range f.Metadata {
+		if _, ok := props[k]; !ok {
+			props[k] = v
+		}
+	}
+	return props, nil
+}
+
+func init() {
+	fileCmd.AddCommand(findFileCmd)
+
+	findFileCmd.Flags().StringArrayVar(&fileQueries, "query", make([]string, 0), "File query")
+	findFileCmd.Flags().StringVar(&whereFlag, "where", "", whereUse)
+	findFileCmd.Flags().StringVar(&fileFindCollection, "collection", "", "Only find files in this collection and the collections below it")
+	findFileCmd.Flags().StringVar(&fileFindRetentionPolicy, "retention-policy", "", "Only find files with this retention policy")
+	addListFlags(findFileCmd)
+}
@@ -0,0 +1,418 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/antihax/optional"
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"github.com/spf13/cobra"
+)
+
+const defaultUploadKeyTemplate = "{{.Collection}}-{{slug .Path}}"
+
+var (
+	uploadDirCollection         string
+	uploadDirKeyTemplate        string
+	uploadDirCollectionTemplate string
+	uploadDirConcurrency        int
+	uploadDirStorageService     string
+)
+
+var slugPattern = regexp.MustCompile(`[^A-Za-z0-9._]+`)
+
+// UploadKeyData is passed to the key templates of `file upload-dir`.
+type UploadKeyData struct {
+	Collection string
+	Path       string
+	Dir        string
+	Name       string
+	Base       string
+	Ext        string
+}
+
+// UploadResult is the outcome of uploading or creating one item.
+type UploadResult struct {
+	Path   string `json:"path"`
+	Key    string `json:"key"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+const (
+	UploadStatusCreated = "created"
+	UploadStatusSkipped = "skipped"
+	UploadStatusFailed  = "failed"
+)
+
+// KeyTemplate renders deterministic Hiarc keys from local paths.
+type KeyTemplate struct {
+	t *template.Template
+}
+
+func NewKeyTemplate(text string) (*KeyTemplate, error) {
+	t, err := template.New("key").Funcs(template.FuncMap{
+		"slug":  Slugify,
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+	}).Parse(text)
+	if err != nil {
+		return nil, NewValidationError("Invalid key template %q: %v", text, err)
+	}
+	return &KeyTemplate{t: t}, nil
+}
+
+// Key renders the key for relPath, a slash separated path relative to the
+// uploaded directory.
+func (kt *KeyTemplate) Key(collection string, relPath string) (string, error) {
+	base := path.Base(relPath)
+	ext := path.Ext(base)
+	dir := path.Dir(relPath)
+	if dir == "." {
+		dir = ""
+	}
+	var b strings.Builder
+	err := kt.t.Execute(&b, UploadKeyData{
+		Collection: collection,
+		Path:       relPath,
+		Dir:        dir,
+		Name:       base,
+		Base:       strings.TrimSuffix(base, ext),
+		Ext:        strings.TrimPrefix(ext, "."),
+	})
+	if err != nil {
+		return "", err
+	}
+	key := b.String()
+	if key == "" {
+		return "", fmt.Errorf("Key template produced an empty key for %s", relPath)
+	}
+	return key, nil
+}
+
+// Slugify replaces anything but letters, digits, dots and underscores with a dash.
+func Slugify(s string) string {
+	return strings.Trim(slugPattern.ReplaceAllString(s, "-"), "-")
+}
+
+type uploadDirJob struct {
+	localPath     string
+	relPath       string
+	key           string
+	collectionKey string
+}
+
+var uploadDirCmd = &cobra.Command{
+	Use:   "upload-dir [local directory]",
+	Short: "Upload a local directory into a tree of collections",
+	Long: `Upload every file below a local directory. Each subdirectory becomes a
+collection linked to its parent, and each file is created and added to the
+collection of its directory. Keys come from Go templates with the fields
+.Collection, .Path, .Dir, .Name, .Base and .Ext and the functions slug, lower
+and upper. Files and collections whose keys already exist are skipped, so an
+interrupted upload can be resumed by running the same command again. Paths
+that map to the same key are refused before anything is uploaded. The
+auto-classification rules of the profile are applied to every file, and
+again to skipped files so a resumed upload finishes applying them; see
+"hiarc rules --help".`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := args[0]
+		s, err := os.Stat(root)
+		if err != nil {
+			return err
+		}
+		if !s.IsDir() {
+			return NewValidationError("%s is not a directory", root)
+		}
+		if uploadDirConcurrency < 1 {
+			return NewValidationError("--concurrency must be at least 1")
+		}
+		fileKeys, err := NewKeyTemplate(uploadDirKeyTemplate)
+		if err != nil {
+			return err
+		}
+		collectionKeys, err := NewKeyTemplate(uploadDirCollectionTemplate)
+		if err != nil {
+			return err
+		}
+
+		rules, err := ProfileRules()
+		if err != nil {
+			return err
+		}
+
+		hiarcClient := ConfigureHiarcClient()
+		asUser, _ := rootCmd.Flags().GetString("as-user")
+		u := &dirUploader{
+			client:         hiarcClient,
+			asUser:         asUser,
+			storageService: uploadDirStorageService,
+			rules:          rules,
+		}
+
+		// Work out every key before creating anything: different paths can
+		// slug to the same key, and the second one would then be skipped as
+		// already uploaded.
+		dirKeys := map[string]string{".": uploadDirCollection}
+		collectionPaths := map[string]string{uploadDirCollection: "."}
+		filePaths := map[string]string{}
+		dirs := []uploadDirJob{}
+		jobs := []uploadDirJob{}
+		err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			if rel == "." {
+				return nil
+			}
+			rel = filepath.ToSlash(rel)
+			parentKey := dirKeys[path.Dir(rel)]
+			if info.IsDir() {
+				key, err := collectionKeys.Key(uploadDirCollection, rel)
+				if err != nil {
+					return err
+				}
+				if other, ok := collectionPaths[key]; ok {
+					return NewValidationError("%s and %s both map to collection key %s, change --collection-key-template", other, rel, key)
+				}
+				collectionPaths[key] = rel
+				dirKeys[rel] = key
+				dirs = append(dirs, uploadDirJob{localPath: p, relPath: rel, key: key, collectionKey: parentKey})
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			key, err := fileKeys.Key(uploadDirCollection, rel)
+			if err != nil {
+				return err
+			}
+			if other, ok := filePaths[key]; ok {
+				return NewValidationError("%s and %s both map to file key %s, change --key-template", other, rel, key)
+			}
+			filePaths[key] = rel
+			jobs = append(jobs, uploadDirJob{localPath: p, relPath: rel, key: key, collectionKey: parentKey})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		results := []UploadResult{}
+		if _, err := u.ensureCollection(uploadDirCollection, uploadDirCollection, ""); err != nil {
+			return err
+		}
+		// Directories come parents first. Nothing below a directory whose
+		// collection couldn't be created is uploaded.
+		failedDirs := map[string]bool{}
+		below := func(rel string) bool {
+			for d := path.Dir(rel); d != "."; d = path.Dir(d) {
+				if failedDirs[d] {
+					return true
+				}
+			}
+			return false
+		}
+		for _, d := range dirs {
+			if below(d.relPath) {
+				failedDirs[d.relPath] = true
+				continue
+			}
+			result := UploadResult{Path: d.relPath, Key: d.key, Type: "collection"}
+			created, err := u.ensureCollection(d.key, path.Base(d.relPath), d.collectionKey)
+			result.Status = statusFor(created, err, &result)
+			results = append(results, result)
+			log.Println(fmt.Sprintf("Collection %s: %s", d.key, result.Status))
+			if err != nil {
+				failedDirs[d.relPath] = true
+			}
+		}
+		var uploads []uploadDirJob
+		for _, j := range jobs {
+			if !below(j.relPath) {
+				uploads = append(uploads, j)
+			}
+		}
+		results = append(results, u.uploadAll(uploads, uploadDirConcurrency)...)
+		failed := 0
+		for _, r := range results {
+			if r.Status == UploadStatusFailed {
+				failed++
+			}
+		}
+		if err := PrintResult(results); err != nil {
+			return err
+		}
+		if failed > 0 {
+			return NewPartialFailure(failed, len(results), "items failed to upload")
+		}
+		return nil
+	},
+}
+
+type dirUploader struct {
+	client         *hiarc.APIClient
+	asUser         string
+	storageService string
+	rules          *Rules
+}
+
+// ensureCollection creates the collection if it doesn't exist yet and links
+// it to its parent. It reports whether the collection was created.
+func (u *dirUploader) ensureCollection(key string, name string, parentKey string) (bool, error) {
+	getOpts := hiarc.GetCollectionOpts{}
+	if u.asUser != "" {
+		getOpts.XHiarcUserKey = optional.NewString(u.asUser)
+	}
+	created := false
+	_, r, err := u.client.CollectionApi.GetCollection(context.Background(), key, &getOpts)
+	if err != nil {
+		apiErr := NewAPIError("CollectionApi.GetCollection", r, err)
+		if !IsNotFound(apiErr) {
+			return false, apiErr
+		}
+		opts := hiarc.CreateCollectionOpts{}
+		if u.asUser != "" {
+			opts.XHiarcUserKey = optional.NewString(u.asUser)
+		}
+		ccr := hiarc.CreateCollectionRequest{Key: key, Name: name}
+		if _, r, err := u.client.CollectionApi.CreateCollection(context.Background(), ccr, &opts); err != nil {
+			return false, NewAPIError("CollectionApi.CreateCollection", r, err)
+		}
+		created = true
+	}
+	if parentKey == "" {
+		return created, nil
+	}
+	opts := hiarc.AddChildToCollectionOpts{}
+	if u.asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(u.asUser)
+	}
+	_, r, err = u.client.CollectionApi.AddChildToCollection(context.Background(), parentKey, key, &opts)
+	if err != nil {
+		if apiErr := NewAPIError("CollectionApi.AddChildToCollection", r, err); !IsConflict(apiErr) {
+			return created, apiErr
+		}
+	}
+	return created, nil
+}
+
+// uploadAll runs the jobs on a bounded pool of workers.
+func (u *dirUploader) uploadAll(jobs []uploadDirJob, workers int) []UploadResult {
+	results := make([]UploadResult, len(jobs))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				j := jobs[i]
+				result := UploadResult{Path: j.relPath, Key: j.key, Type: "file"}
+				created, err := u.uploadFile(j)
+				result.Status = statusFor(created, err, &result)
+				results[i] = result
+
+				mu.Lock()
+				done++
+				log.Println(fmt.Sprintf("[%d/%d] %s -> %s: %s", done, len(jobs), j.relPath, j.key, result.Status))
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	sort.SliceStable(results, func(a, b int) bool { return results[a].Path < results[b].Path })
+	return results
+}
+
+func (u *dirUploader) uploadFile(j uploadDirJob) (bool, error) {
+	getOpts := hiarc.GetFileOpts{}
+	if u.asUser != "" {
+		getOpts.XHiarcUserKey = optional.NewString(u.asUser)
+	}
+	created := false
+	applied, err := u.rules.Evaluate(RuleInput{Path: j.localPath, Name: path.Base(j.relPath), Collection: j.collectionKey})
+	if err != nil {
+		return false, err
+	}
+	_, r, err := u.client.FileApi.GetFile(context.Background(), j.key, &getOpts)
+	if err != nil {
+		apiErr := NewAPIError("FileApi.GetFile", r, err)
+		if !IsNotFound(apiErr) {
+			return false, apiErr
+		}
+		cf := hiarc.CreateFileRequest{Key: j.key, Name: path.Base(j.relPath), StorageService: u.storageService}
+		if len(applied.Metadata) > 0 {
+			cf.Metadata = applied.Metadata
+		}
+		t := NewTransfer(u.client, u.asUser)
+		t.Progress = false
+		if _, err := t.CreateFile(j.localPath, cf); err != nil {
+			return false, err
+		}
+		created = true
+	}
+
+	opts := hiarc.AddFileToCollectionOpts{}
+	if u.asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(u.asUser)
+	}
+	afcr := hiarc.AddFileToCollectionRequest{FileKey: j.key}
+	_, r, err = u.client.CollectionApi.AddFileToCollection(context.Background(), j.collectionKey, afcr, &opts)
+	if err != nil {
+		if apiErr := NewAPIError("CollectionApi.AddFileToCollection", r, err); !IsConflict(apiErr) {
+			return created, apiErr
+		}
+	}
+	// The rules are applied to existing files too, in case the run that
+	// created them stopped before applying them.
+	if err := applyRules(u.client, u.asUser, j.key, applied); err != nil {
+		return created, err
+	}
+	return created, nil
+}
+
+func statusFor(created bool, err error, result *UploadResult) string {
+	if err != nil {
+		result.Error = err.Error()
+		return UploadStatusFailed
+	}
+	if created {
+		return UploadStatusCreated
+	}
+	return UploadStatusSkipped
+}
+
+func init() {
+	fileCmd.AddCommand(uploadDirCmd)
+
+	uploadDirCmd.Flags().StringVar(&uploadDirCollection, "collection", "", "Key of the root collection to upload into (required)")
+	uploadDirCmd.MarkFlagRequired("collection")
+	uploadDirCmd.Flags().StringVar(&uploadDirKeyTemplate, "key-template", defaultUploadKeyTemplate, "Go template used to derive file keys")
+	uploadDirCmd.Flags().StringVar(&uploadDirCollectionTemplate, "collection-key-template", defaultUploadKeyTemplate, "Go template used to derive collection keys for subdirectories")
+	uploadDirCmd.Flags().IntVar(&uploadDirConcurrency, "concurrency", 4, "Number of files to upload at the same time")
+	uploadDirCmd.Flags().StringVar(&uploadDirStorageService, "storage-service", "", "Service used to store files")
+	uploadDirCmd.Flags().IntVar(&transferRetries, "retries", defaultRetries, transferRetriesUse)
+}
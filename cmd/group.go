@@ -2,10 +2,8 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 
 	hiarc "github.com/hiarcdb/hiarc-go-sdk"
 	"github.com/antihax/optional"
@@ -29,14 +27,14 @@ var createGroupCmd = &cobra.Command{
 	Use:   "create [group key]",
 	Short: "Create a group",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 
 		cgr := hiarc.CreateGroupRequest{Key: args[0]}
 		if groupMetadata != "" {
 			md, err := ConvertMetadataStringToObject(groupMetadata)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			cgr.Metadata = md
 		}
@@ -48,11 +46,9 @@ var createGroupCmd = &cobra.Command{
 		}
 		group, r, err := hiarcClient.GroupApi.CreateGroup(context.Background(), cgr)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `GroupApi.CreateGroup``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("GroupApi.CreateGroup", r, err)
 		}
-		jsonData, err := json.MarshalIndent(group, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(group)
 	},
 }
 
@@ -60,31 +56,27 @@ var getGroupCmd = &cobra.Command{
 	Use:   "get [group key]",
 	Short: "Get group by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		group, r, err := hiarcClient.GroupApi.GetGroup(context.Background(), args[0])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `GroupApi.GetGroup``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("GroupApi.GetGroup", r, err)
 		}
-		jsonData, err := json.MarshalIndent(group, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(group)
 	},
 }
 
 var getAllGroupsCmd = &cobra.Command{
 	Use:   "all",
 	Short: "Get all groups",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 
 		groups, r, err := hiarcClient.GroupApi.GetAllGroups(context.Background())
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `GroupApi.GetAllGroups``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("GroupApi.GetAllGroups", r, err)
 		}
-		jsonData, err := json.MarshalIndent(groups, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintList(cmd, NewSliceIterator(groups))
 	},
 }
 
@@ -92,7 +84,7 @@ var getGroupsForUserGroupCmd = &cobra.Command{
 	Use:   "for-user [user key]",
 	Short: "Get all groups for a user",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.GetGroupsForUserOpts{}
@@ -102,18 +94,16 @@ var getGroupsForUserGroupCmd = &cobra.Command{
 
 		group, r, err := hiarcClient.GroupsApi.GetGroupsForUser(context.Background(), args[0], &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `GroupApi.GetGroupsForCurrentUser``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("GroupsApi.GetGroupsForUser", r, err)
 		}
-		jsonData, err := json.MarshalIndent(group, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(group)
 	},
 }
 
 var getGroupsCurrentUserCmd = &cobra.Command{
 	Use:   "current",
 	Short: "Get all groups for current user",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.GetGroupsForCurrentUserOpts{}
@@ -123,11 +113,9 @@ var getGroupsCurrentUserCmd = &cobra.Command{
 
 		group, r, err := hiarcClient.GroupApi.GetGroupsForCurrentUser(context.Background(), &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `GroupApi.GetGroupsForCurrentUser``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("GroupApi.GetGroupsForCurrentUser", r, err)
 		}
-		jsonData, err := json.MarshalIndent(group, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(group)
 	},
 }
 
@@ -135,14 +123,14 @@ var updateGroupCmd = &cobra.Command{
 	Use:   "update [group key]",
 	Short: "Update a group",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 
 		ugr := hiarc.UpdateGroupRequest{}
 		if groupMetadata != "" {
 			md, err := ConvertMetadataStringToObject(groupMetadata)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			ugr.Metadata = md
 		}
@@ -154,11 +142,9 @@ var updateGroupCmd = &cobra.Command{
 		}
 		group, r, err := hiarcClient.GroupApi.UpdateGroup(context.Background(), args[0], ugr)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `GroupApi.UpdateGroup``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("GroupApi.UpdateGroup", r, err)
 		}
-		jsonData, err := json.MarshalIndent(group, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(group)
 	},
 }
 
@@ -166,14 +152,17 @@ var deleteGroupCmd = &cobra.Command{
 	Use:   "delete [group key]",
 	Short: "Delete a group",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := ConfirmDestructive(fmt.Sprintf("delete group %s", args[0])); err != nil {
+			return err
+		}
 		hiarcClient := ConfigureHiarcClient()
 		_, r, err := hiarcClient.GroupApi.DeleteGroup(context.Background(), args[0])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `GroupApi.DeleteGroup``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("GroupApi.DeleteGroup", r, err)
 		}
 		log.Println(fmt.Sprintf("Deleted group: %s", args[0]))
+		return nil
 	},
 }
 
@@ -181,38 +170,32 @@ var addUserToGroupCmd = &cobra.Command{
 	Use:   "add-user [group key] [user key]",
 	Short: "Add a user to a group",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		_, r, err := hiarcClient.GroupApi.AddUserToGroup(context.Background(), args[0], args[1])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `GroupApi.AddUserToGroup``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("GroupApi.AddUserToGroup", r, err)
 		}
 		log.Println(fmt.Sprintf("Added user %s to group %s", args[1], args[0]))
+		return nil
 	},
 }
 
 var findGroupCmd = &cobra.Command{
 	Use:   "find",
 	Short: "Find group by query",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
-		queries := make([]map[string]interface{}, 0)
-		for i := range groupQueries {
-			q, err := ConvertQueryToObject(groupQueries[i])
-			if err != nil {
-				log.Fatal(err)
-			}
-			queries = append(queries, q)
+		queries, err := FindQuery(groupQueries, whereFlag)
+		if err != nil {
+			return err
 		}
 		qr := hiarc.FindGroupsRequest{Query: queries}
 		fg, r, err := hiarcClient.GroupApi.FindGroup(context.Background(), qr)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `GroupApi.FindGroup``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("GroupApi.FindGroup", r, err)
 		}
-		jsonData, err := json.MarshalIndent(fg, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintList(cmd, NewSliceIterator(fg))
 	},
 }
 
@@ -222,6 +205,7 @@ func init() {
 	groupCmd.AddCommand(getGroupCmd)
 	groupCmd.AddCommand(updateGroupCmd)
 	groupCmd.AddCommand(deleteGroupCmd)
+	addConfirmFlag(deleteGroupCmd)
 	groupCmd.AddCommand(addUserToGroupCmd)
 	groupCmd.AddCommand(findGroupCmd)
 
@@ -239,5 +223,7 @@ func init() {
 	updateGroupCmd.Flags().StringVar(&groupMetadata, "metadata", "", "Group metadata")
 
 	findGroupCmd.Flags().StringArrayVar(&groupQueries, "query", make([]string, 0), "Group query")
-	findGroupCmd.MarkFlagRequired("query")
+	findGroupCmd.Flags().StringVar(&whereFlag, "where", "", whereUse)
+	addListFlags(getAllGroupsCmd)
+	addListFlags(findGroupCmd)
 }
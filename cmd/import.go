@@ -0,0 +1,460 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"github.com/spf13/cobra"
+)
+
+// Import file formats.
+const (
+	ImportFormatCSV       = "csv"
+	ImportFormatJSONLines = "jsonl"
+)
+
+const (
+	ImportStatusCreated = "created"
+	ImportStatusUpdated = "updated"
+	ImportStatusAdded   = "added"
+	ImportStatusSkipped = "skipped"
+	ImportStatusFailed  = "failed"
+)
+
+var (
+	importFile        string
+	importFormat      string
+	importUpsert      bool
+	importConcurrency int
+	importRate        float64
+	importReport      string
+)
+
+// ImportRow is one user, group or membership read from an import file.
+type ImportRow struct {
+	Line        int                    `json:"line"`
+	Key         string                 `json:"key"`
+	Name        string                 `json:"name,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	GroupKey    string                 `json:"groupKey,omitempty"`
+	UserKey     string                 `json:"userKey,omitempty"`
+}
+
+// ImportResult is the outcome of importing one row.
+type ImportResult struct {
+	Line   int    `json:"line"`
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import users, groups and memberships in bulk",
+	Long: `Import users, groups and group memberships from a CSV file with a header
+row or from JSON lines.
+
+Users and groups use the columns key, name, description and metadata (a JSON
+object). Additional metadata.<name> columns set a single metadata value, and
+can be typed as metadata.<name>:<type> where type is string, int, float, bool,
+time or json. Memberships use the columns groupKey and userKey.
+
+Rows are imported concurrently, limited to --rate requests per second. Users
+and groups that already exist are skipped, or updated with --upsert. A result
+for each row is printed and, with --report, written to a file.
+
+With --from, import restores an export made with hiarc export instead.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if importFrom == "" {
+			return cmd.Help()
+		}
+		results, err := RestoreBackup(ConfigureHiarcClient(), importFrom)
+		if err != nil {
+			return err
+		}
+		if err := PrintResult(results); err != nil {
+			return err
+		}
+		failed := 0
+		for _, r := range results {
+			if r.Status == ImportStatusFailed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return NewPartialFailure(failed, len(results), "items failed to restore")
+		}
+		return nil
+	},
+}
+
+var importUsersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "Create or update users from a file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hiarcClient := ConfigureHiarcClient()
+		return runImport(func(row ImportRow, wait func()) (string, error) {
+			return importUser(hiarcClient, row, wait)
+		})
+	},
+}
+
+var importGroupsCmd = &cobra.Command{
+	Use:   "groups",
+	Short: "Create or update groups from a file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hiarcClient := ConfigureHiarcClient()
+		return runImport(func(row ImportRow, wait func()) (string, error) {
+			return importGroup(hiarcClient, row, wait)
+		})
+	},
+}
+
+var importMembershipsCmd = &cobra.Command{
+	Use:   "memberships",
+	Short: "Add users to groups from a file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hiarcClient := ConfigureHiarcClient()
+		return runImport(func(row ImportRow, wait func()) (string, error) {
+			return importMembership(hiarcClient, row, wait)
+		})
+	},
+}
+
+func importUser(hiarcClient *hiarc.APIClient, row ImportRow, wait func()) (string, error) {
+	if row.Key == "" {
+		return ImportStatusFailed, NewValidationError("Users need a key")
+	}
+	cu := hiarc.CreateUserRequest{Key: row.Key, Name: row.Name, Description: row.Description, Metadata: row.Metadata}
+	wait()
+	_, r, err := hiarcClient.UserApi.CreateUser(context.Background(), cu)
+	if err == nil {
+		return ImportStatusCreated, nil
+	}
+	apiErr := NewAPIError("UserApi.CreateUser", r, err)
+	if !IsConflict(apiErr) {
+		return ImportStatusFailed, apiErr
+	}
+	if !importUpsert {
+		return ImportStatusSkipped, nil
+	}
+	wait()
+	uu := hiarc.UpdateUserRequest{Name: row.Name, Description: row.Description, Metadata: row.Metadata}
+	if _, r, err := hiarcClient.UserApi.UpdateUser(context.Background(), row.Key, uu); err != nil {
+		return ImportStatusFailed, NewAPIError("UserApi.UpdateUser", r, err)
+	}
+	return ImportStatusUpdated, nil
+}
+
+func importGroup(hiarcClient *hiarc.APIClient, row ImportRow, wait func()) (string, error) {
+	if row.Key == "" {
+		return ImportStatusFailed, NewValidationError("Groups need a key")
+	}
+	cg := hiarc.CreateGroupRequest{Key: row.Key, Name: row.Name, Description: row.Description, Metadata: row.Metadata}
+	wait()
+	_, r, err := hiarcClient.GroupApi.CreateGroup(context.Background(), cg)
+	if err == nil {
+		return ImportStatusCreated, nil
+	}
+	apiErr := NewAPIError("GroupApi.CreateGroup", r, err)
+	if !IsConflict(apiErr) {
+		return ImportStatusFailed, apiErr
+	}
+	if !importUpsert {
+		return ImportStatusSkipped, nil
+	}
+	wait()
+	ug := hiarc.UpdateGroupRequest{Name: row.Name, Description: row.Description, Metadata: row.Metadata}
+	if _, r, err := hiarcClient.GroupApi.UpdateGroup(context.Background(), row.Key, ug); err != nil {
+		return ImportStatusFailed, NewAPIError("GroupApi.UpdateGroup", r, err)
+	}
+	return ImportStatusUpdated, nil
+}
+
+func importMembership(hiarcClient *hiarc.APIClient, row ImportRow, wait func()) (string, error) {
+	if row.GroupKey == "" || row.UserKey == "" {
+		return ImportStatusFailed, NewValidationError("Memberships need both a groupKey and a userKey")
+	}
+	wait()
+	_, r, err := hiarcClient.GroupApi.AddUserToGroup(context.Background(), row.GroupKey, row.UserKey)
+	if err != nil {
+		if apiErr := NewAPIError("GroupApi.AddUserToGroup", r, err); !IsConflict(apiErr) {
+			return ImportStatusFailed, apiErr
+		}
+		return ImportStatusSkipped, nil
+	}
+	return ImportStatusAdded, nil
+}
+
+// runImport reads the import file and runs fn for each row on a pool of
+// workers. fn calls wait before each request to stay within the rate limit.
+func runImport(fn func(row ImportRow, wait func()) (string, error)) error {
+	if importFile == "" {
+		return NewValidationError("--file is required")
+	}
+	if importConcurrency < 1 {
+		return NewValidationError("--concurrency must be at least 1")
+	}
+	if importRate <= 0 {
+		return NewValidationError("--rate must be greater than 0")
+	}
+	rows, err := ReadImportFile(importFile, importFormat)
+	if err != nil {
+		return err
+	}
+
+	limiter := time.NewTicker(time.Duration(float64(time.Second) / importRate))
+	defer limiter.Stop()
+	wait := func() { <-limiter.C }
+	results := make([]ImportResult, len(rows))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+	for w := 0; w < importConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				row := rows[i]
+				key := row.Key
+				if key == "" && (row.GroupKey != "" || row.UserKey != "") {
+					key = fmt.Sprintf("%s/%s", row.GroupKey, row.UserKey)
+				}
+				status, err := fn(row, wait)
+				results[i] = ImportResult{Line: row.Line, Key: key, Status: status}
+				if err != nil {
+					results[i].Error = err.Error()
+				}
+
+				mu.Lock()
+				done++
+				log.Println(fmt.Sprintf("[%d/%d] %s: %s", done, len(rows), key, status))
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range rows {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	if importReport != "" {
+		jsonData, err := json.MarshalIndent(results, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(importReport, jsonData, 0644); err != nil {
+			return err
+		}
+	}
+	if err := PrintResult(results); err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Status == ImportStatusFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return NewPartialFailure(failed, len(results), "rows failed to import")
+	}
+	return nil
+}
+
+// ReadImportFile parses a CSV or JSON lines import file. The format is taken
+// from the file extension when it isn't given.
+func ReadImportFile(p string, format string) ([]ImportRow, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(p)) {
+		case ".csv":
+			format = ImportFormatCSV
+		case ".json", ".jsonl", ".ndjson":
+			format = ImportFormatJSONLines
+		default:
+			return nil, NewValidationError("Can't tell the format of %s, use --format %s or %s", p, ImportFormatCSV, ImportFormatJSONLines)
+		}
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch format {
+	case ImportFormatCSV:
+		return readImportCSV(f)
+	case ImportFormatJSONLines:
+		return readImportJSONLines(f)
+	}
+	return nil, NewValidationError("%s is not a valid import format. Choose from the following: %s or %s", format, ImportFormatCSV, ImportFormatJSONLines)
+}
+
+func readImportCSV(r io.Reader) ([]ImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return []ImportRow{}, nil
+	}
+	if err != nil {
+		return nil, NewValidationError("Invalid CSV header: %v", err)
+	}
+
+	rows := []ImportRow{}
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, NewValidationError("Invalid CSV: %v", err)
+		}
+		row := ImportRow{Line: line}
+		for i, column := range header {
+			if i >= len(record) {
+				break
+			}
+			if err := row.set(strings.TrimSpace(column), record[i]); err != nil {
+				return nil, NewValidationError("Line %d, column %s: %v", line, column, err)
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// set assigns a CSV value to the field named by column.
+func (row *ImportRow) set(column string, value string) error {
+	switch column {
+	case "key":
+		row.Key = value
+	case "name":
+		row.Name = value
+	case "description":
+		row.Description = value
+	case "groupKey":
+		row.GroupKey = value
+	case "userKey":
+		row.UserKey = value
+	case "metadata":
+		if value == "" {
+			return nil
+		}
+		md, err := ConvertMetadataStringToObject(value)
+		if err != nil {
+			return err
+		}
+		for k, v := range md {
+			row.setMetadata(k, v)
+		}
+	default:
+		if !strings.HasPrefix(column, "metadata.") {
+			return fmt.Errorf("unknown column")
+		}
+		if value == "" {
+			return nil
+		}
+		name, kind := strings.TrimPrefix(column, "metadata."), "string"
+		if i := strings.LastIndex(name, ":"); i >= 0 {
+			name, kind = name[:i], name[i+1:]
+		}
+		v, err := ParseTypedValue(value, kind)
+		if err != nil {
+			return err
+		}
+		row.setMetadata(name, v)
+	}
+	return nil
+}
+
+func (row *ImportRow) setMetadata(name string, v interface{}) {
+	if row.Metadata == nil {
+		row.Metadata = map[string]interface{}{}
+	}
+	row.Metadata[name] = v
+}
+
+// ParseTypedValue converts a metadata value from text to the named type.
+func ParseTypedValue(value string, kind string) (interface{}, error) {
+	switch kind {
+	case "string":
+		return value, nil
+	case "int":
+		return strconv.ParseInt(value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(value, 64)
+	case "bool":
+		return strconv.ParseBool(value)
+	case "time":
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, err
+		}
+		return t.UTC().Format(time.RFC3339), nil
+	case "json":
+		var v interface{}
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown type %s, use string, int, float, bool, time or json", kind)
+}
+
+func readImportJSONLines(r io.Reader) ([]ImportRow, error) {
+	rows := []ImportRow{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		row := ImportRow{}
+		if err := json.Unmarshal(text, &row); err != nil {
+			return nil, NewValidationError("Line %d: %v", line, err)
+		}
+		row.Line = line
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.AddCommand(importUsersCmd)
+	importCmd.AddCommand(importGroupsCmd)
+	importCmd.AddCommand(importMembershipsCmd)
+
+	importCmd.PersistentFlags().StringVar(&importFile, "file", "", "CSV or JSON lines file to import")
+	importCmd.PersistentFlags().StringVar(&importFormat, "format", "", "Format of the file: csv or jsonl (default is taken from the file extension)")
+	importCmd.PersistentFlags().BoolVar(&importUpsert, "upsert", false, "Update users and groups that already exist")
+	importCmd.PersistentFlags().IntVar(&importConcurrency, "concurrency", 4, "Number of rows to import at the same time")
+	importCmd.PersistentFlags().Float64Var(&importRate, "rate", 10, "Maximum number of requests per second")
+	importCmd.PersistentFlags().StringVar(&importReport, "report", "", "Write the result of each row to this file as JSON")
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTypedValue(t *testing.T) {
+	tests := []struct {
+		value string
+		kind  string
+		want  interface{}
+	}{
+		{"sales", "string", "sales"},
+		{"42", "int", int64(42)},
+		{"-7", "int", int64(-7)},
+		{"2.5", "float", 2.5},
+		{"true", "bool", true},
+		{"0", "bool", false},
+		{"2020-03-01T12:00:00+02:00", "time", "2020-03-01T10:00:00Z"},
+		{`{"a": [1, "b"]}`, "json", map[string]interface{}{"a": []interface{}{float64(1), "b"}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseTypedValue(tt.value, tt.kind)
+		if err != nil {
+			t.Errorf("ParseTypedValue(%q, %q) failed: %v", tt.value, tt.kind, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTypedValue(%q, %q) = %#v, want %#v", tt.value, tt.kind, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ value, kind string }{
+		{"4.5", "int"},
+		{"many", "float"},
+		{"yes please", "bool"},
+		{"2020-03-01", "time"},
+		{"{", "json"},
+		{"1", "decimal"},
+	} {
+		if got, err := ParseTypedValue(tt.value, tt.kind); err == nil {
+			t.Errorf("ParseTypedValue(%q, %q) = %#v, want an error", tt.value, tt.kind, got)
+		}
+	}
+}
+
+func TestReadImportFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hiarc-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("csv", func(t *testing.T) {
+		p := writeTestFile(t, dir, "users.CSV", `key,name, metadata.level:int,metadata.active:bool,metadata.team,metadata
+alice,Alice,3,true,sales,"{""region"": ""emea""}"
+bob,"Bob, Jr.",,false,,
+carol,,,,,
+`)
+		rows, err := ReadImportFile(p, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []ImportRow{
+			{Line: 2, Key: "alice", Name: "Alice", Metadata: map[string]interface{}{"level": int64(3), "active": true, "team": "sales", "region": "emea"}},
+			{Line: 3, Key: "bob", Name: "Bob, Jr.", Metadata: map[string]interface{}{"active": false}},
+			{Line: 4, Key: "carol"},
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("rows = %+v, want %+v", rows, want)
+		}
+
+		memberships := writeTestFile(t, dir, "members.txt", "groupKey,userKey\nsales,alice\n")
+		rows, err = ReadImportFile(memberships, ImportFormatCSV)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []ImportRow{{Line: 2, GroupKey: "sales", UserKey: "alice"}}; !reflect.DeepEqual(rows, want) {
+			t.Errorf("rows = %+v, want %+v", rows, want)
+		}
+	})
+
+	t.Run("json lines", func(t *testing.T) {
+		p := writeTestFile(t, dir, "groups.jsonl", `{"key": "sales", "name": "Sales", "metadata": {"size": 12}}
+
+{"key": "hr", "description": "People"}
+`)
+		rows, err := ReadImportFile(p, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []ImportRow{
+			{Line: 1, Key: "sales", Name: "Sales", Metadata: map[string]interface{}{"size": float64(12)}},
+			{Line: 3, Key: "hr", Description: "People"},
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("rows = %+v, want %+v", rows, want)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			content string
+			format  string
+			want    string
+		}{
+			{"users.txt", "key\na\n", "", "Can't tell the format"},
+			{"users.csv", "key\na\n", "xml", "not a valid import format"},
+			{"users.csv", "key,email\na,a@example.com\n", "", "Line 2, column email: unknown column"},
+			{"users.csv", "key,metadata.level:int\na,high\n", "", "Line 2, column metadata.level:int"},
+			{"users.csv", "key,name\na,\"unterminated\n", "", "Invalid CSV"},
+			{"users.jsonl", "{\"key\": \"a\"}\n{\"key\": \n", "", "Line 2"},
+		}
+		for _, tt := range tests {
+			_, err := ReadImportFile(writeTestFile(t, dir, tt.name, tt.content), tt.format)
+			if err == nil {
+				t.Errorf("ReadImportFile(%q) succeeded, want an error", tt.content)
+				continue
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ReadImportFile(%q) error = %q, want it to contain %q", tt.content, err.Error(), tt.want)
+			}
+			if ExitCodeFor(err) != ExitValidation {
+				t.Errorf("ReadImportFile(%q) exit code = %d, want %d", tt.content, ExitCodeFor(err), ExitValidation)
+			}
+		}
+	})
+}
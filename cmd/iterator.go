@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultPageSize = 100
+
+var (
+	listLimit    int
+	listPageSize int
+	listAll      bool
+)
+
+// addListFlags registers --limit, --page-size and --all on a list command.
+func addListFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&listLimit, "limit", 0, "Return at most this many items, 0 for no limit")
+	cmd.Flags().IntVar(&listPageSize, "page-size", defaultPageSize, "Print this many items at a time. Hiarc returns lists in full, so this doesn't change what is fetched")
+	cmd.Flags().BoolVar(&listAll, "all", false, "Return every item, the same as --limit 0")
+}
+
+// Iterator hands out the items of a list one page at a time. Hiarc's list
+// endpoints return everything in one response, so most iterators page over
+// a slice, while file find fetches collection by collection as pages are
+// asked for.
+type Iterator struct {
+	PageSize int
+	source   func() ([]interface{}, error)
+	buffer   []interface{}
+	done     bool
+}
+
+// NewSliceIterator pages over items, a slice.
+func NewSliceIterator(items interface{}) *Iterator {
+	all := toItems(items)
+	if reflect.ValueOf(items).Kind() != reflect.Slice {
+		all = nil
+	}
+	return NewFuncIterator(func() ([]interface{}, error) {
+		batch := all
+		all = nil
+		return batch, nil
+	})
+}
+
+// NewFuncIterator pages over the batches next returns, until it returns an
+// empty batch.
+func NewFuncIterator(next func() ([]interface{}, error)) *Iterator {
+	return &Iterator{PageSize: defaultPageSize, source: next}
+}
+
+// Next returns the next page, which is empty once the list is exhausted.
+func (it *Iterator) Next() ([]interface{}, error) {
+	size := it.PageSize
+	if size <= 0 {
+		size = defaultPageSize
+	}
+	for !it.done && len(it.buffer) < size {
+		batch, err := it.source()
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			it.done = true
+		}
+		it.buffer = append(it.buffer, batch...)
+	}
+	if len(it.buffer) < size {
+		size = len(it.buffer)
+	}
+	page := it.buffer[:size]
+	it.buffer = it.buffer[size:]
+	return page, nil
+}
+
+// PrintList prints the items of it using the format selected by --output,
+// honouring the --limit, --page-size and --all flags of cmd. JSON and JSON
+// lines are written page by page, other formats need the whole list.
+func PrintList(cmd *cobra.Command, it *Iterator) error {
+	if listAll && cmd.Flags().Changed("limit") {
+		return NewValidationError("Use either --all or --limit, not both")
+	}
+	if listPageSize <= 0 || listLimit < 0 {
+		return NewValidationError("--page-size must be positive and --limit can't be negative")
+	}
+	limit := listLimit
+	if listAll {
+		limit = 0
+	}
+	it.PageSize = listPageSize
+
+	p, err := NewPrinter(outputFlag, os.Stdout)
+	if err != nil {
+		return err
+	}
+	count, truncated, err := p.PrintList(it, limit)
+	if err != nil {
+		return err
+	}
+	if truncated {
+		fmt.Fprintf(os.Stderr, "Showing the first %d items, pass --all or a higher --limit to see more\n", count)
+	}
+	return nil
+}
+
+// PrintList prints up to limit items of it, or all of them when limit is 0.
+// It returns how many were printed and whether more were left.
+func (p *Printer) PrintList(it *Iterator, limit int) (int, bool, error) {
+	var collected []interface{}
+	count := 0
+	truncated := false
+	for {
+		page, err := it.Next()
+		if err != nil {
+			if p.format == OutputJSON && count > 0 {
+				fmt.Fprintln(p.out, "\n]")
+			}
+			return count, false, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		if limit > 0 && count+len(page) > limit {
+			page = page[:limit-count]
+			truncated = true
+		}
+
+		switch p.format {
+		case OutputJSON:
+			for _, item := range page {
+				jsonData, err := json.MarshalIndent(item, "    ", "    ")
+				if err != nil {
+					return count, false, err
+				}
+				sep := ",\n"
+				if count == 0 {
+					sep = "[\n"
+				}
+				fmt.Fprintf(p.out, "%s    %s", sep, jsonData)
+				count++
+			}
+		case OutputJSONLines:
+			if err := p.printJSONLines(page); err != nil {
+				return count, false, err
+			}
+			count += len(page)
+		default:
+			collected = append(collected, page...)
+			count += len(page)
+		}
+
+		if limit > 0 && count == limit {
+			if !truncated {
+				more, err := it.Next()
+				truncated = err == nil && len(more) > 0
+			}
+			break
+		}
+	}
+
+	switch p.format {
+	case OutputJSON:
+		if count == 0 {
+			fmt.Fprintln(p.out, "[]")
+		} else {
+			fmt.Fprintln(p.out, "\n]")
+		}
+	case OutputJSONLines:
+	default:
+		if err := p.Print(typedSlice(collected)); err != nil {
+			return count, false, err
+		}
+	}
+	return count, truncated, nil
+}
+
+// typedSlice turns items back into a slice of their own type, so the table
+// output picks the columns of known resources.
+func typedSlice(items []interface{}) interface{} {
+	if len(items) == 0 {
+		return []interface{}{}
+	}
+	s := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(items[0])), len(items), len(items))
+	for i, item := range items {
+		s.Index(i).Set(reflect.ValueOf(item))
+	}
+	return s.Interface()
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EvaluateJSONPath renders a kubectl-style jsonpath template such as
+// `{.key}`, `{[*].name}` or `{range [*]}{.key}{"\n"}{end}` against data
+// produced by toGeneric. Text outside of braces is copied as-is and multiple
+// matches of a single expression are separated by spaces.
+func EvaluateJSONPath(expr string, data interface{}) (string, error) {
+	nodes, err := parseJSONPathTemplate(expr)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := renderJSONPath(&b, nodes, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+type jsonPathNode struct {
+	text     string
+	path     []jsonPathStep
+	isPath   bool
+	isRange  bool
+	children []jsonPathNode
+}
+
+type jsonPathStep struct {
+	field    string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func parseJSONPathTemplate(expr string) ([]jsonPathNode, error) {
+	root := []jsonPathNode{}
+	stack := [][]jsonPathNode{}
+	ranges := []jsonPathNode{}
+	cur := &root
+
+	for len(expr) > 0 {
+		open := strings.Index(expr, "{")
+		if open < 0 {
+			*cur = append(*cur, jsonPathNode{text: expr})
+			break
+		}
+		if open > 0 {
+			*cur = append(*cur, jsonPathNode{text: expr[:open]})
+		}
+		end := strings.Index(expr[open:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("Invalid jsonpath %q: unclosed '{'", expr)
+		}
+		inner := strings.TrimSpace(expr[open+1 : open+end])
+		expr = expr[open+end+1:]
+
+		switch {
+		case strings.HasPrefix(inner, "\""):
+			text, err := strconv.Unquote(inner)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid jsonpath literal %s: %v", inner, err)
+			}
+			*cur = append(*cur, jsonPathNode{text: text})
+		case strings.HasPrefix(inner, "range "):
+			path, err := parseJSONPath(strings.TrimSpace(strings.TrimPrefix(inner, "range ")))
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, *cur)
+			ranges = append(ranges, jsonPathNode{isRange: true, path: path})
+			next := []jsonPathNode{}
+			cur = &next
+		case inner == "end":
+			if len(ranges) == 0 {
+				return nil, fmt.Errorf("Invalid jsonpath: {end} without {range}")
+			}
+			r := ranges[len(ranges)-1]
+			ranges = ranges[:len(ranges)-1]
+			r.children = *cur
+			parent := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			parent = append(parent, r)
+			cur = &parent
+		default:
+			path, err := parseJSONPath(inner)
+			if err != nil {
+				return nil, err
+			}
+			*cur = append(*cur, jsonPathNode{isPath: true, path: path})
+		}
+	}
+	if len(ranges) > 0 {
+		return nil, fmt.Errorf("Invalid jsonpath: {range} without {end}")
+	}
+	return *cur, nil
+}
+
+// parseJSONPath parses expressions such as `.metadata.owner`, `[0].key` or
+// `$[*].name` into a list of steps.
+func parseJSONPath(p string) ([]jsonPathStep, error) {
+	steps := []jsonPathStep{}
+	p = strings.TrimPrefix(p, "$")
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			n := strings.IndexAny(p, ".[")
+			if n < 0 {
+				n = len(p)
+			}
+			field := p[:n]
+			p = p[n:]
+			if field == "" {
+				continue
+			}
+			if field == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else {
+				steps = append(steps, jsonPathStep{field: field})
+			}
+		case '[':
+			n := strings.Index(p, "]")
+			if n < 0 {
+				return nil, fmt.Errorf("Invalid jsonpath %q: unclosed '['", p)
+			}
+			sel := strings.TrimSpace(p[1:n])
+			p = p[n+1:]
+			switch {
+			case sel == "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			case strings.HasPrefix(sel, "'") && strings.HasSuffix(sel, "'") && len(sel) >= 2:
+				steps = append(steps, jsonPathStep{field: sel[1 : len(sel)-1]})
+			default:
+				i, err := strconv.Atoi(sel)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid jsonpath index %q", sel)
+				}
+				steps = append(steps, jsonPathStep{index: i, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("Invalid jsonpath %q: expected '.' or '['", p)
+		}
+	}
+	return steps, nil
+}
+
+func renderJSONPath(b *strings.Builder, nodes []jsonPathNode, data interface{}) error {
+	for _, n := range nodes {
+		switch {
+		case n.isRange:
+			for _, item := range selectJSONPath(n.path, data) {
+				if err := renderJSONPath(b, n.children, item); err != nil {
+					return err
+				}
+			}
+		case n.isPath:
+			values := selectJSONPath(n.path, data)
+			for i, v := range values {
+				if i > 0 {
+					b.WriteString(" ")
+				}
+				b.WriteString(formatJSONPathValue(v))
+			}
+		default:
+			b.WriteString(n.text)
+		}
+	}
+	return nil
+}
+
+func selectJSONPath(steps []jsonPathStep, data interface{}) []interface{} {
+	current := []interface{}{data}
+	for _, s := range steps {
+		next := []interface{}{}
+		for _, c := range current {
+			switch val := c.(type) {
+			case map[string]interface{}:
+				if s.wildcard {
+					for _, k := range sortedKeys(val) {
+						next = append(next, val[k])
+					}
+				} else if v, ok := val[s.field]; ok && !s.isIndex {
+					next = append(next, v)
+				}
+			case []interface{}:
+				if s.wildcard {
+					next = append(next, val...)
+				} else if s.isIndex {
+					i := s.index
+					if i < 0 {
+						i += len(val)
+					}
+					if i >= 0 && i < len(val) {
+						next = append(next, val[i])
+					}
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+func formatJSONPathValue(v interface{}) string {
+	switch val := v.(type) {
+	case map[string]interface{}, []interface{}, float64:
+		return formatCell(val)
+	case string:
+		return val
+	case nil:
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
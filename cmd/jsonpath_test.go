@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const jsonPathTestData = `[
+	{"key": "file-1", "name": "a.pdf", "versionCount": 3, "metadata": {"owner": "alice", "tags": ["x", "y"]}},
+	{"key": "file-2", "name": "b.txt", "versionCount": 1.5, "metadata": {"owner": "bob", "reviewed": true}},
+	{"key": "file-3", "name": "c", "versionCount": 1, "metadata": null}
+]`
+
+func TestEvaluateJSONPath(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(jsonPathTestData), &data); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`{[0].key}`, "file-1"},
+		{`{$[1].name}`, "b.txt"},
+		{`{[-1].key}`, "file-3"},
+		{`{[*].key}`, "file-1 file-2 file-3"},
+		{`{[*].versionCount}`, "3 1.5 1"},
+		{`{[0].metadata.owner}`, "alice"},
+		{`{[0].metadata['owner']}`, "alice"},
+		{`{[0].metadata.tags[1]}`, "y"},
+		{`{[0].metadata.tags}`, "x, y"},
+		{`{[1].metadata.*}`, "bob true"},
+		{`{[2].metadata}`, ""},
+		{`{[0].missing}`, ""},
+		{`{[7].key}`, ""},
+		{`key={[0].key}, owner={[0].metadata.owner}`, "key=file-1, owner=alice"},
+		{`{range [*]}{.key}{"\t"}{.metadata.owner}{"\n"}{end}`, "file-1\talice\nfile-2\tbob\nfile-3\t\n"},
+		{`{range [*]}{range .metadata.tags[*]}{.}{","}{end}{end}`, "x,y,"},
+		{`no braces`, "no braces"},
+	}
+	for _, tt := range tests {
+		got, err := EvaluateJSONPath(tt.expr, data)
+		if err != nil {
+			t.Errorf("EvaluateJSONPath(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("EvaluateJSONPath(%q) = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateJSONPathErrors(t *testing.T) {
+	for _, expr := range []string{
+		`{.key`,
+		`{[0}`,
+		`{[a].key}`,
+		`{key}`,
+		`{"unterminated}`,
+		`{range [*]}{.key}`,
+		`{.key}{end}`,
+	} {
+		if got, err := EvaluateJSONPath(expr, map[string]interface{}{}); err == nil {
+			t.Errorf("EvaluateJSONPath(%q) = %q, want an error", expr, got)
+		}
+	}
+}
@@ -23,10 +23,6 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"log"
-	"os"
 
 	hiarc "github.com/hiarcdb/hiarc-go-sdk"
 	"github.com/spf13/cobra"
@@ -41,20 +37,23 @@ var (
 var legalHoldCmd = &cobra.Command{
 	Use:   "legal-hold",
 	Short: "Legal Hold commands for Hiarc",
-	Run:   nil,
+	Long: `Legal Hold commands for Hiarc. Hiarc's API can only create and get legal
+holds; it can't list, update or find them, apply them to files or release
+them.`,
+	Run: nil,
 }
 
 var createLegalHoldCmd = &cobra.Command{
 	Use:   "create [legal hold key]",
 	Short: "Create Legal Hold with a key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		clh := hiarc.CreateLegalHoldRequest{Key: args[0]}
 		if legalHoldMetadata != "" {
 			md, err := ConvertMetadataStringToObject(legalHoldMetadata)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			clh.Metadata = md
 		}
@@ -67,11 +66,9 @@ var createLegalHoldCmd = &cobra.Command{
 
 		hold, r, err := hiarcClient.LegalHoldApi.CreateLegalHold(context.Background(), clh)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `LegalHoldApi.CreateLegalHold``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("LegalHoldApi.CreateLegalHold", r, err)
 		}
-		jsonData, err := json.MarshalIndent(hold, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(hold)
 	},
 }
 
@@ -79,16 +76,14 @@ var getLegalHoldCmd = &cobra.Command{
 	Use:   "get [legal hold key]",
 	Short: "Get Legal Hold by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 
 		hold, r, err := hiarcClient.LegalHoldApi.GetLegalHold(context.Background(), args[0])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `LegalHoldApi.GetLegalHold``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("LegalHoldApi.GetLegalHold", r, err)
 		}
-		jsonData, err := json.MarshalIndent(hold, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(hold)
 	},
 }
 
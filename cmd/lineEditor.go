@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	maxHistory       = 1000
+	maxListedChoices = 100
+	listWidth        = 80
+)
+
+// lineEditor reads lines from a terminal with history and tab completion.
+// When stdin isn't a terminal it reads plain lines instead.
+type lineEditor struct {
+	in          *os.File
+	out         io.Writer
+	reader      *bufio.Reader
+	history     []string
+	historyPath string
+	// complete returns the candidates for the word ending at the end of
+	// line, and the index in line where that word starts.
+	complete func(line string) ([]string, int)
+}
+
+func newLineEditor(historyPath string, complete func(line string) ([]string, int)) *lineEditor {
+	e := &lineEditor{
+		in:          os.Stdin,
+		out:         os.Stdout,
+		reader:      bufio.NewReader(os.Stdin),
+		historyPath: historyPath,
+		complete:    complete,
+	}
+	if data, err := ioutil.ReadFile(historyPath); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				e.history = append(e.history, line)
+			}
+		}
+		if len(e.history) > maxHistory {
+			e.history = e.history[len(e.history)-maxHistory:]
+		}
+	}
+	return e
+}
+
+// AddHistory records a line in memory and in the history file.
+func (e *lineEditor) AddHistory(line string) {
+	if line == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if e.historyPath == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// ReadLine shows prompt and returns the line typed, or io.EOF on ctrl-d.
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	fd := int(e.in.Fd())
+	var state *terminalState
+	var err error
+	if isTerminal(e.in) {
+		state, err = makeRaw(fd)
+	}
+	if state == nil || err != nil {
+		fmt.Fprint(e.out, prompt)
+		line, err := e.reader.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	defer restoreTerminal(fd, state)
+	return e.edit(prompt)
+}
+
+func (e *lineEditor) edit(prompt string) (string, error) {
+	var buf []rune
+	cursor := 0
+	// position in history, len(history) is the line being typed
+	hpos := len(e.history)
+	scratch := ""
+	lastTab := false
+
+	refresh := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if n := len(buf) - cursor; n > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", n)
+		}
+	}
+	setLine := func(s string) {
+		buf = []rune(s)
+		cursor = len(buf)
+		refresh()
+	}
+	insert := func(rs []rune) {
+		buf = append(buf[:cursor], append(rs, buf[cursor:]...)...)
+		cursor += len(rs)
+		refresh()
+	}
+
+	refresh()
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		tab := r == '\t'
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case 3: // ctrl-c
+			fmt.Fprint(e.out, "^C\r\n")
+			buf, cursor, hpos = nil, 0, len(e.history)
+			refresh()
+		case 4: // ctrl-d
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if cursor < len(buf) {
+				buf = append(buf[:cursor], buf[cursor+1:]...)
+				refresh()
+			}
+		case 127, 8: // backspace
+			if cursor > 0 {
+				buf = append(buf[:cursor-1], buf[cursor:]...)
+				cursor--
+				refresh()
+			}
+		case 1: // ctrl-a
+			cursor = 0
+			refresh()
+		case 5: // ctrl-e
+			cursor = len(buf)
+			refresh()
+		case 11: // ctrl-k
+			buf = buf[:cursor]
+			refresh()
+		case 21: // ctrl-u
+			buf = buf[cursor:]
+			cursor = 0
+			refresh()
+		case 23: // ctrl-w
+			start := cursor
+			for start > 0 && buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && buf[start-1] != ' ' {
+				start--
+			}
+			buf = append(buf[:start], buf[cursor:]...)
+			cursor = start
+			refresh()
+		case 12: // ctrl-l
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+			refresh()
+		case '\t':
+			if e.complete == nil || cursor != len(buf) {
+				fmt.Fprint(e.out, "\a")
+				break
+			}
+			line := string(buf)
+			candidates, start := e.complete(line)
+			word := line[start:]
+			switch {
+			case len(candidates) == 0:
+				fmt.Fprint(e.out, "\a")
+			case len(candidates) == 1:
+				insert([]rune(strings.TrimPrefix(candidates[0], word) + " "))
+			default:
+				if prefix := commonPrefix(candidates); len(prefix) > len(word) {
+					insert([]rune(strings.TrimPrefix(prefix, word)))
+				} else if lastTab {
+					fmt.Fprint(e.out, "\r\n")
+					e.list(candidates)
+					refresh()
+				} else {
+					fmt.Fprint(e.out, "\a")
+				}
+			}
+		case 27: // escape sequences for the arrow, home, end and delete keys
+			next, _, err := e.reader.ReadRune()
+			if err != nil {
+				return "", err
+			}
+			if next != '[' && next != 'O' {
+				break
+			}
+			key, _, err := e.reader.ReadRune()
+			if err != nil {
+				return "", err
+			}
+			switch key {
+			case 'A':
+				if hpos > 0 {
+					if hpos == len(e.history) {
+						scratch = string(buf)
+					}
+					hpos--
+					setLine(e.history[hpos])
+				}
+			case 'B':
+				if hpos < len(e.history) {
+					hpos++
+					if hpos == len(e.history) {
+						setLine(scratch)
+					} else {
+						setLine(e.history[hpos])
+					}
+				}
+			case 'C':
+				if cursor < len(buf) {
+					cursor++
+					refresh()
+				}
+			case 'D':
+				if cursor > 0 {
+					cursor--
+					refresh()
+				}
+			case 'H':
+				cursor = 0
+				refresh()
+			case 'F':
+				cursor = len(buf)
+				refresh()
+			case '3':
+				if t, _, _ := e.reader.ReadRune(); t == '~' && cursor < len(buf) {
+					buf = append(buf[:cursor], buf[cursor+1:]...)
+					refresh()
+				}
+			}
+		default:
+			if r >= 32 {
+				insert([]rune{r})
+			}
+		}
+		lastTab = tab
+	}
+}
+
+// list prints candidates in columns.
+func (e *lineEditor) list(candidates []string) {
+	shown := candidates
+	if len(shown) > maxListedChoices {
+		shown = shown[:maxListedChoices]
+	}
+	width := 0
+	for _, c := range shown {
+		if len(c) > width {
+			width = len(c)
+		}
+	}
+	width += 2
+	columns := listWidth / width
+	if columns < 1 {
+		columns = 1
+	}
+	for i, c := range shown {
+		fmt.Fprintf(e.out, "%-*s", width, c)
+		if (i+1)%columns == 0 || i == len(shown)-1 {
+			fmt.Fprint(e.out, "\r\n")
+		}
+	}
+	if len(candidates) > len(shown) {
+		fmt.Fprintf(e.out, "... and %d more\r\n", len(candidates)-len(shown))
+	}
+}
+
+func commonPrefix(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	prefix := values[0]
+	for _, v := range values[1:] {
+		for !strings.HasPrefix(v, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
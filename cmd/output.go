@@ -0,0 +1,372 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	OutputJSON       = "json"
+	OutputJSONLines  = "jsonl"
+	OutputYAML       = "yaml"
+	OutputTable      = "table"
+	OutputCSV        = "csv"
+	OutputGoTemplate = "go-template="
+	OutputJSONPath   = "jsonpath="
+)
+
+var outputFlag string
+
+var (
+	entityColumns          = []string{"key", "name", "description", "createdBy", "createdAt"}
+	fileColumns            = []string{"key", "name", "versionCount", "createdBy", "createdAt", "modifiedAt"}
+	retentionPolicyColumns = []string{"key", "name", "seconds", "createdBy", "createdAt"}
+	uploadResultColumns    = []string{"type", "path", "key", "status", "error"}
+	manifestEntryColumns   = []string{"path", "fileKey", "collectionKey", "versionCount", "status", "error"}
+	syncActionColumns      = []string{"action", "path", "key", "reason", "status", "error"}
+	importResultColumns    = []string{"line", "key", "status", "error"}
+	restoreResultColumns   = []string{"type", "key", "status", "error"}
+	accessColumns          = []string{"file", "user", "canRead", "groups", "collections"}
+	planActionColumns      = []string{"action", "key", "detail", "status", "error"}
+	retentionReportColumns = []string{"key", "name", "policies", "deletableAt", "daysLeft", "status"}
+	deleteResultColumns    = []string{"type", "key", "status", "reason"}
+	classifyResultColumns  = []string{"key", "status", "error"}
+	rulesResultColumns     = []string{"path", "mimeType", "size", "rules", "classifications", "retentionPolicies", "metadata"}
+)
+
+// Printer renders command results to an output stream in a single format.
+type Printer struct {
+	format string
+	expr   string
+	out    io.Writer
+}
+
+// NewPrinter parses an --output value such as "yaml" or "go-template={{.key}}".
+func NewPrinter(output string, out io.Writer) (*Printer, error) {
+	p := &Printer{out: out}
+	switch {
+	case output == "" || output == OutputJSON:
+		p.format = OutputJSON
+	case output == OutputJSONLines, output == OutputYAML, output == OutputTable, output == OutputCSV:
+		p.format = output
+	case strings.HasPrefix(output, OutputGoTemplate):
+		p.format = OutputGoTemplate
+		p.expr = strings.TrimPrefix(output, OutputGoTemplate)
+	case strings.HasPrefix(output, OutputJSONPath):
+		p.format = OutputJSONPath
+		p.expr = strings.TrimPrefix(output, OutputJSONPath)
+	default:
+		return nil, fmt.Errorf("Unknown output format %q. Choose from json, jsonl, yaml, table, csv, go-template=... or jsonpath=...", output)
+	}
+	if (p.format == OutputGoTemplate || p.format == OutputJSONPath) && p.expr == "" {
+		return nil, fmt.Errorf("Output format %s requires an expression", p.format)
+	}
+	return p, nil
+}
+
+// PrintResult writes v to stdout using the format selected by --output.
+func PrintResult(v interface{}) error {
+	p, err := NewPrinter(outputFlag, os.Stdout)
+	if err != nil {
+		return err
+	}
+	return p.Print(v)
+}
+
+func (p *Printer) Print(v interface{}) error {
+	switch p.format {
+	case OutputJSONLines:
+		return p.printJSONLines(v)
+	case OutputYAML:
+		return p.printYAML(v)
+	case OutputTable:
+		return p.printTable(v)
+	case OutputCSV:
+		return p.printCSV(v)
+	case OutputGoTemplate:
+		return p.printTemplate(v)
+	case OutputJSONPath:
+		return p.printJSONPath(v)
+	}
+	jsonData, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(p.out, string(jsonData))
+	return err
+}
+
+func (p *Printer) printJSONLines(v interface{}) error {
+	for _, item := range toItems(v) {
+		jsonData, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(p.out, string(jsonData)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Printer) printYAML(v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	yamlData, err := yaml.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	_, err = p.out.Write(yamlData)
+	return err
+}
+
+func (p *Printer) printTemplate(v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	t, err := template.New("output").Parse(p.expr)
+	if err != nil {
+		return fmt.Errorf("Invalid go-template: %v", err)
+	}
+	if err := t.Execute(p.out, generic); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(p.out)
+	return err
+}
+
+func (p *Printer) printJSONPath(v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	result, err := EvaluateJSONPath(p.expr, generic)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(p.out, result)
+	return err
+}
+
+func (p *Printer) printTable(v interface{}) error {
+	items := toItems(v)
+	rows := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		generic, err := toGeneric(item)
+		if err != nil {
+			return err
+		}
+		row, ok := generic.(map[string]interface{})
+		if !ok {
+			// Scalars such as the keys returned by `file filter` print one per line.
+			if _, err := fmt.Fprintln(p.out, formatCell(generic)); err != nil {
+				return err
+			}
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	columns := defaultColumns(v)
+	if columns == nil {
+		columns = sortedKeys(rows[0])
+	}
+	w := tabwriter.NewWriter(p.out, 0, 0, 3, ' ', 0)
+	headers := make([]string, len(columns))
+	for i, c := range columns {
+		headers[i] = columnHeader(c)
+	}
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		for i, c := range columns {
+			cells[i] = formatCell(row[c])
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	return w.Flush()
+}
+
+// printCSV writes the same columns as the table output, with the property
+// names as the header.
+func (p *Printer) printCSV(v interface{}) error {
+	w := csv.NewWriter(p.out)
+	var columns []string
+	for _, item := range toItems(v) {
+		generic, err := toGeneric(item)
+		if err != nil {
+			return err
+		}
+		row, ok := generic.(map[string]interface{})
+		if !ok {
+			w.Write([]string{formatCell(generic)})
+			continue
+		}
+		if columns == nil {
+			if columns = defaultColumns(v); columns == nil {
+				columns = sortedKeys(row)
+			}
+			w.Write(columns)
+		}
+		record := make([]string, len(columns))
+		for i, c := range columns {
+			record[i] = formatCell(row[c])
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// defaultColumns returns the table columns for known Hiarc resources, or nil
+// when the columns should be derived from the data.
+func defaultColumns(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil
+	}
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch reflect.Zero(t).Interface().(type) {
+	case hiarc.File:
+		return fileColumns
+	case hiarc.RetentionPolicy:
+		return retentionPolicyColumns
+	case hiarc.User, hiarc.Group, hiarc.Collection, hiarc.Classification, hiarc.LegalHold:
+		return entityColumns
+	case UploadResult:
+		return uploadResultColumns
+	case ManifestEntry:
+		return manifestEntryColumns
+	case SyncAction:
+		return syncActionColumns
+	case ImportResult:
+		return importResultColumns
+	case RestoreResult:
+		return restoreResultColumns
+	case AccessExplanation:
+		return accessColumns
+	case PlanAction:
+		return planActionColumns
+	case RetentionReportEntry:
+		return retentionReportColumns
+	case DeleteResult:
+		return deleteResultColumns
+	case ClassifyResult:
+		return classifyResultColumns
+	case RulesResult:
+		return rulesResultColumns
+	}
+	return nil
+}
+
+// toItems flattens slices into their elements so each can be printed on its
+// own line or row.
+func toItems(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return []interface{}{v}
+	}
+	items := make([]interface{}, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items
+}
+
+// toGeneric round-trips v through JSON so every format sees the same field
+// names as the json output.
+func toGeneric(v interface{}) (interface{}, error) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(jsonData, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func columnHeader(c string) string {
+	var b strings.Builder
+	for i, r := range c {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToUpper(b.String())
+}
+
+func formatCell(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+			if t.IsZero() {
+				return ""
+			}
+			return t.Format("2006-01-02 15:04:05")
+		}
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case []interface{}:
+		// Lists of strings, such as keys, read better without JSON quoting.
+		strs := make([]string, len(val))
+		for i, item := range val {
+			str, ok := item.(string)
+			if !ok {
+				strs = nil
+				break
+			}
+			strs[i] = str
+		}
+		if strs != nil {
+			return strings.Join(strs, ", ")
+		}
+		jsonData, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Sprintf("%v", val)
+		}
+		return string(jsonData)
+	case map[string]interface{}:
+		jsonData, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Sprintf("%v", val)
+		}
+		return string(jsonData)
+	}
+	return fmt.Sprintf("%v", v)
+}
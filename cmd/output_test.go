@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+)
+
+func TestPrinterLargeNumbers(t *testing.T) {
+	policies := []hiarc.RetentionPolicy{{Key: "seven-years", Name: "Seven years", Seconds: 220752000}}
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{OutputTable, "KEY           NAME          SECONDS     CREATED BY   CREATED AT\nseven-years   Seven years   220752000                \n"},
+		{OutputCSV, "key,name,seconds,createdBy,createdAt\nseven-years,Seven years,220752000,,\n"},
+		{OutputJSONPath + "{[0].seconds}", "220752000\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		p, err := NewPrinter(tt.output, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Print(policies); err != nil {
+			t.Fatalf("%s: %v", tt.output, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s output = %q, want %q", tt.output, out.String(), tt.want)
+		}
+	}
+}
+
+func TestFormatCell(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{nil, ""},
+		{float64(1.5), "1.5"},
+		{float64(12345678901), "12345678901"},
+		{float64(-0.000001), "-0.000001"},
+		{"2020-03-01T10:00:00Z", "2020-03-01 10:00:00"},
+		{[]interface{}{"x", "y"}, "x, y"},
+		{[]interface{}{float64(1), "y"}, `[1,"y"]`},
+	}
+	for _, tt := range tests {
+		if got := formatCell(tt.v); got != tt.want {
+			t.Errorf("formatCell(%#v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const whereUse = `Query expression, such as: department ^= "sal" and (quotaCarrying = true or level >= 3)`
+
+var whereFlag string
+
+// whereOperators maps the operators of a --where expression to the ones
+// Hiarc queries use, longest first so ">=" isn't read as ">".
+var whereOperators = []struct {
+	token string
+	op    string
+}{
+	{"starts with", "starts with"},
+	{"ends with", "ends with"},
+	{"contains", "contains"},
+	{"!=", "!="},
+	{"<>", "!="},
+	{">=", ">="},
+	{"<=", "<="},
+	{"^=", "starts with"},
+	{"$=", "ends with"},
+	{"*=", "contains"},
+	{"==", "="},
+	{"=", "="},
+	{">", ">"},
+	{"<", "<"},
+}
+
+// FindQuery builds the query of a find command from either --where or the
+// raw JSON --query fragments.
+func FindQuery(queries []string, where string) ([]map[string]interface{}, error) {
+	if where != "" && len(queries) > 0 {
+		return nil, NewValidationError("Use either --where or --query, not both")
+	}
+	if where != "" {
+		return ParseWhere(where)
+	}
+	if len(queries) == 0 {
+		return nil, NewValidationError("A query is required, pass --where or --query")
+	}
+	result := make([]map[string]interface{}, 0)
+	for i := range queries {
+		q, err := ConvertQueryToObject(queries[i])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, q)
+	}
+	return result, nil
+}
+
+// ParseWhere parses an expression such as
+//
+//	department ^= "sal" and (quotaCarrying = true or level >= 3)
+//
+// into the list of query items Hiarc takes: {"prop", "op", "value"} for each
+// comparison, {"bool": "and"} or {"bool": "or"} between them, and
+// {"parens": "("} and {"parens": ")"} for grouping. Values are strings in
+// single or double quotes, numbers, true, false or null.
+func ParseWhere(expr string) ([]map[string]interface{}, error) {
+	p := &whereParser{expr: []rune(expr)}
+	if err := p.expression(); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.expr) {
+		return nil, p.errorf("unexpected %q, expected and, or or the end of the expression", p.rest(1))
+	}
+	return p.items, nil
+}
+
+type whereParser struct {
+	expr  []rune
+	pos   int
+	items []map[string]interface{}
+}
+
+// errorf reports a parse error with the expression and a caret under the
+// column it happened at.
+func (p *whereParser) errorf(format string, args ...interface{}) error {
+	return NewValidationError("Invalid --where at column %d: %s\n  %s\n  %s^", p.pos+1, fmt.Sprintf(format, args...), string(p.expr), strings.Repeat(" ", p.pos))
+}
+
+func (p *whereParser) skipSpace() {
+	for p.pos < len(p.expr) && unicode.IsSpace(p.expr[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *whereParser) rest(n int) string {
+	end := p.pos + n
+	if end > len(p.expr) {
+		end = len(p.expr)
+	}
+	return string(p.expr[p.pos:end])
+}
+
+// keyword consumes word if it comes next as a whole word, ignoring case.
+func (p *whereParser) keyword(word string) bool {
+	n := len([]rune(word))
+	if !strings.EqualFold(p.rest(n), word) {
+		return false
+	}
+	if end := p.pos + n; end < len(p.expr) && isIdentRune(p.expr[end]) && isIdentRune(p.expr[end-1]) {
+		return false
+	}
+	p.pos += n
+	return true
+}
+
+// expression parses comparisons and groups joined by and or or.
+func (p *whereParser) expression() error {
+	for {
+		if err := p.term(); err != nil {
+			return err
+		}
+		p.skipSpace()
+		switch {
+		case p.keyword("and") || p.keyword("&&"):
+			p.items = append(p.items, map[string]interface{}{"bool": "and"})
+		case p.keyword("or") || p.keyword("||"):
+			p.items = append(p.items, map[string]interface{}{"bool": "or"})
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *whereParser) term() error {
+	p.skipSpace()
+	if p.pos >= len(p.expr) {
+		return p.errorf("unexpected end of the expression, expected a property or (")
+	}
+	if p.expr[p.pos] == '(' {
+		open := p.pos
+		p.pos++
+		p.items = append(p.items, map[string]interface{}{"parens": "("})
+		if err := p.expression(); err != nil {
+			return err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.expr) || p.expr[p.pos] != ')' {
+			p.pos = open
+			return p.errorf("unclosed (")
+		}
+		p.pos++
+		p.items = append(p.items, map[string]interface{}{"parens": ")"})
+		return nil
+	}
+	return p.comparison()
+}
+
+func (p *whereParser) comparison() error {
+	start := p.pos
+	for p.pos < len(p.expr) && isIdentRune(p.expr[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return p.errorf("unexpected %q, expected a property or (", p.rest(1))
+	}
+	prop := string(p.expr[start:p.pos])
+
+	p.skipSpace()
+	op := ""
+	for _, o := range whereOperators {
+		if p.keyword(o.token) {
+			op = o.op
+			break
+		}
+	}
+	if op == "" {
+		return p.errorf("expected an operator after %s: =, !=, >, >=, <, <=, ^= (starts with), $= (ends with) or *= (contains)", prop)
+	}
+
+	p.skipSpace()
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	p.items = append(p.items, map[string]interface{}{"prop": prop, "op": op, "value": value})
+	return nil
+}
+
+// value parses a quoted string, a number, true, false or null.
+func (p *whereParser) value() (interface{}, error) {
+	if p.pos >= len(p.expr) {
+		return nil, p.errorf("unexpected end of the expression, expected a value")
+	}
+	if q := p.expr[p.pos]; q == '"' || q == '\'' {
+		start := p.pos
+		p.pos++
+		var b strings.Builder
+		for p.pos < len(p.expr) {
+			r := p.expr[p.pos]
+			p.pos++
+			switch {
+			case r == '\\' && p.pos < len(p.expr):
+				b.WriteRune(p.expr[p.pos])
+				p.pos++
+			case r == q:
+				return b.String(), nil
+			default:
+				b.WriteRune(r)
+			}
+		}
+		p.pos = start
+		return nil, p.errorf("unterminated string")
+	}
+
+	start := p.pos
+	for p.pos < len(p.expr) && (isIdentRune(p.expr[p.pos]) || strings.ContainsRune("+-.", p.expr[p.pos])) {
+		p.pos++
+	}
+	word := string(p.expr[start:p.pos])
+	switch strings.ToLower(word) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if i, err := strconv.ParseInt(word, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, nil
+	}
+	p.pos = start
+	if word == "" {
+		return nil, p.errorf("unexpected %q, expected a value", p.rest(1))
+	}
+	return nil, p.errorf("invalid value %s, quote strings with \" or '", word)
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// MatchQuery evaluates query items, as built by FindQuery, against props on
+// the client, for entities Hiarc can't search itself. As in Hiarc, "and"
+// binds tighter than "or". A property name with dots, such as
+// metadata.department, looks into nested objects.
+func MatchQuery(query []map[string]interface{}, props map[string]interface{}) (bool, error) {
+	m := &queryMatcher{items: query, props: props}
+	ok, err := m.or()
+	if err != nil {
+		return false, err
+	}
+	if m.pos < len(m.items) {
+		return false, NewValidationError("Invalid query: unexpected %v", m.items[m.pos])
+	}
+	return ok, nil
+}
+
+type queryMatcher struct {
+	items []map[string]interface{}
+	pos   int
+	props map[string]interface{}
+}
+
+func (m *queryMatcher) next(key string, value string) bool {
+	if m.pos < len(m.items) {
+		if v, ok := m.items[m.pos][key].(string); ok && strings.EqualFold(v, value) {
+			m.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (m *queryMatcher) or() (bool, error) {
+	result, err := m.and()
+	for err == nil && m.next("bool", "or") {
+		var r bool
+		r, err = m.and()
+		result = result || r
+	}
+	return result, err
+}
+
+func (m *queryMatcher) and() (bool, error) {
+	result, err := m.term()
+	for err == nil && m.next("bool", "and") {
+		var r bool
+		r, err = m.term()
+		result = result && r
+	}
+	return result, err
+}
+
+func (m *queryMatcher) term() (bool, error) {
+	if m.next("parens", "(") {
+		result, err := m.or()
+		if err != nil {
+			return false, err
+		}
+		if !m.next("parens", ")") {
+			return false, NewValidationError("Invalid query: unclosed (")
+		}
+		return result, nil
+	}
+	if m.pos >= len(m.items) {
+		return false, NewValidationError("Invalid query: expected a comparison at the end")
+	}
+	item := m.items[m.pos]
+	m.pos++
+	prop, ok := item["prop"].(string)
+	if !ok {
+		return false, NewValidationError("Invalid query: expected a comparison, got %v", item)
+	}
+	op, _ := item["op"].(string)
+	return compareValues(lookupProp(m.props, prop), strings.ToLower(op), item["value"])
+}
+
+func lookupProp(props map[string]interface{}, name string) interface{} {
+	if v, ok := props[name]; ok {
+		return v
+	}
+	var current interface{} = props
+	for _, part := range strings.Split(name, ".") {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = obj[part]
+	}
+	return current
+}
+
+func compareValues(actual interface{}, op string, expected interface{}) (bool, error) {
+	switch op {
+	case "=":
+		return valuesEqual(actual, expected), nil
+	case "!=":
+		return !valuesEqual(actual, expected), nil
+	case ">", ">=", "<", "<=":
+		c, ok := orderValues(actual, expected)
+		if !ok {
+			return false, nil
+		}
+		switch op {
+		case ">":
+			return c > 0, nil
+		case ">=":
+			return c >= 0, nil
+		case "<":
+			return c < 0, nil
+		default:
+			return c <= 0, nil
+		}
+	case "starts with", "ends with", "contains":
+		a, ok := actual.(string)
+		e, eok := expected.(string)
+		if !ok || !eok {
+			return false, nil
+		}
+		switch op {
+		case "starts with":
+			return strings.HasPrefix(a, e), nil
+		case "ends with":
+			return strings.HasSuffix(a, e), nil
+		default:
+			return strings.Contains(a, e), nil
+		}
+	}
+	return false, NewValidationError("Invalid query: unknown operator %q", op)
+}
+
+func valuesEqual(actual interface{}, expected interface{}) bool {
+	a, aok := toFloat(actual)
+	e, eok := toFloat(expected)
+	if aok && eok {
+		return a == e
+	}
+	return reflect.DeepEqual(actual, expected)
+}
+
+// orderValues compares numbers as numbers, timestamps as times and other
+// strings as strings.
+func orderValues(actual interface{}, expected interface{}) (int, bool) {
+	if a, ok := toFloat(actual); ok {
+		e, ok := toFloat(expected)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a < e:
+			return -1, true
+		case a > e:
+			return 1, true
+		}
+		return 0, true
+	}
+	a, aok := actual.(string)
+	e, eok := expected.(string)
+	if !aok || !eok {
+		return 0, false
+	}
+	at, aerr := time.Parse(time.RFC3339Nano, a)
+	et, eerr := time.Parse(time.RFC3339Nano, e)
+	if aerr == nil && eerr == nil {
+		switch {
+		case at.Before(et):
+			return -1, true
+		case at.After(et):
+			return 1, true
+		}
+		return 0, true
+	}
+	return strings.Compare(a, e), true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseWhere(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []map[string]interface{}
+	}{
+		{
+			`name = "report"`,
+			[]map[string]interface{}{{"prop": "name", "op": "=", "value": "report"}},
+		},
+		{
+			`department ^= 'sal' and (quotaCarrying = true or level >= 3)`,
+			[]map[string]interface{}{
+				{"prop": "department", "op": "starts with", "value": "sal"},
+				{"bool": "and"},
+				{"parens": "("},
+				{"prop": "quotaCarrying", "op": "=", "value": true},
+				{"bool": "or"},
+				{"prop": "level", "op": ">=", "value": int64(3)},
+				{"parens": ")"},
+			},
+		},
+		{
+			`a != 1.5 || b $= "x\"y" && metadata.c contains null`,
+			[]map[string]interface{}{
+				{"prop": "a", "op": "!=", "value": 1.5},
+				{"bool": "or"},
+				{"prop": "b", "op": "ends with", "value": `x"y`},
+				{"bool": "and"},
+				{"prop": "metadata.c", "op": "contains", "value": nil},
+			},
+		},
+		{
+			`size<10 AND name starts with "q"`,
+			[]map[string]interface{}{
+				{"prop": "size", "op": "<", "value": int64(10)},
+				{"bool": "and"},
+				{"prop": "name", "op": "starts with", "value": "q"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseWhere(tt.expr)
+		if err != nil {
+			t.Errorf("ParseWhere(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseWhere(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseWhereErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{``, "column 1: unexpected end of the expression"},
+		{`name report`, "expected an operator after name"},
+		{`name = report`, "invalid value report"},
+		{`name = "report`, "column 8: unterminated string"},
+		{`(a = 1`, "column 1: unclosed ("},
+		{`a = 1 b = 2`, "expected and, or or the end"},
+		{`a = 1 and`, "expected a property or ("},
+	}
+	for _, tt := range tests {
+		_, err := ParseWhere(tt.expr)
+		if err == nil {
+			t.Errorf("ParseWhere(%q) succeeded, want an error", tt.expr)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseWhere(%q) error = %q, want it to contain %q", tt.expr, err.Error(), tt.want)
+		}
+		if ExitCodeFor(err) != ExitValidation {
+			t.Errorf("ParseWhere(%q) exit code = %d, want %d", tt.expr, ExitCodeFor(err), ExitValidation)
+		}
+	}
+}
+
+func TestMatchQuery(t *testing.T) {
+	props := map[string]interface{}{
+		"name":       "quarterly report.pdf",
+		"size":       float64(2048),
+		"createdAt":  "2020-03-01T10:00:00Z",
+		"department": "sales",
+		"metadata": map[string]interface{}{
+			"level":    float64(3),
+			"reviewed": true,
+		},
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`name = "quarterly report.pdf"`, true},
+		{`name != "quarterly report.pdf"`, false},
+		{`name ^= "quarterly" and name $= ".pdf"`, true},
+		{`name *= "annual"`, false},
+		{`size > 1024`, true},
+		{`size <= 2047`, false},
+		{`size = 2048`, true},
+		{`createdAt >= "2020-02-29T23:00:00-02:00"`, true},
+		{`createdAt < "2020-03-01T11:00:00+02:00"`, false},
+		{`metadata.level >= 3 and metadata.reviewed = true`, true},
+		{`missing = null`, true},
+		{`missing > 1`, false},
+		{`size ^= "2"`, false},
+		// and binds tighter than or.
+		{`department = "hr" and size > 1 or size < 1`, false},
+		{`department = "hr" or size > 1 and size < 4096`, true},
+		{`(department = "hr" or size > 1) and size < 10`, false},
+	}
+	for _, tt := range tests {
+		query, err := ParseWhere(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseWhere(%q) failed: %v", tt.expr, err)
+		}
+		got, err := MatchQuery(query, props)
+		if err != nil {
+			t.Errorf("MatchQuery(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("MatchQuery(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestMatchQueryRawQuery(t *testing.T) {
+	query, err := FindQuery([]string{`{"prop": "department", "op": "=", "value": "sales"}`}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := MatchQuery(query, map[string]interface{}{"department": "sales"})
+	if err != nil || !ok {
+		t.Errorf("MatchQuery = %v, %v, want true", ok, err)
+	}
+
+	if _, err := FindQuery([]string{`{}`}, `a = 1`); err == nil {
+		t.Error("FindQuery with --query and --where succeeded, want an error")
+	}
+	bad := []map[string]interface{}{{"parens": "("}, {"prop": "a", "op": "=", "value": "x"}}
+	if _, err := MatchQuery(bad, map[string]interface{}{}); err == nil {
+		t.Error("MatchQuery with an unclosed ( succeeded, want an error")
+	}
+	unknown := []map[string]interface{}{{"prop": "a", "op": "like", "value": "x"}}
+	if _, err := MatchQuery(unknown, map[string]interface{}{}); err == nil {
+		t.Error("MatchQuery with an unknown operator succeeded, want an error")
+	}
+}
@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"github.com/spf13/cobra"
+)
+
+const (
+	ReportFormatCSV  = "csv"
+	ReportFormatHTML = "html"
+	ReportFormatJSON = "json"
+
+	// ReportCanRead is the access reported for a user Hiarc lets read a
+	// file or collection.
+	ReportCanRead = "read"
+)
+
+var (
+	reportCollection string
+	reportAll        bool
+	reportFiles      []string
+	reportFormat     string
+)
+
+// AccessReport is a matrix of the files and collections every user can read.
+type AccessReport struct {
+	Principals []string            `json:"principals"`
+	Rows       []AccessReportRow   `json:"rows"`
+	Summary    AccessReportSummary `json:"summary"`
+}
+
+// AccessReportRow holds the access to one file or collection, keyed by
+// principal such as "user:alice". Principals without access are left out.
+type AccessReportRow struct {
+	Type   string            `json:"type"`
+	Key    string            `json:"key"`
+	Name   string            `json:"name"`
+	Access map[string]string `json:"access"`
+}
+
+// AccessReportSummary lists the files an audit usually looks at first.
+type AccessReportSummary struct {
+	SingleUserFiles []string `json:"singleUserFiles"`
+	OrphanFiles     []string `json:"orphanFiles"`
+}
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report commands for Hiarc",
+	Run:   nil,
+}
+
+var reportAccessCmd = &cobra.Command{
+	Use:   "access",
+	Short: "Report who can access which files and collections",
+	Long: `Report which users can read the files and collections of a collection
+subtree, or of every collection with --all. Each user's access is checked by
+asking Hiarc for every file and collection as that user, so the report only
+shows what Hiarc lets the user see, and makes a request per user for each
+of them. Hiarc has no endpoint to read grants or access levels, so the level
+a user has, and whether it comes from a group, can't be reported.
+
+The summary lists the files only one user can read, and the files that
+aren't in any collection. Hiarc can't list files, so only files in
+collections are reported, and files outside of collections are only found
+among the keys passed with --file.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if (reportCollection == "") == !reportAll {
+			return NewValidationError("Pass either --collection or --all")
+		}
+		if reportFormat != ReportFormatCSV && reportFormat != ReportFormatHTML && reportFormat != ReportFormatJSON {
+			return NewValidationError("%s is not a valid format. Choose from the following: %s, %s or %s", reportFormat, ReportFormatCSV, ReportFormatHTML, ReportFormatJSON)
+		}
+		report, err := BuildAccessReport(ConfigureHiarcClient(), reportCollection, reportFiles)
+		if err != nil {
+			return err
+		}
+		switch reportFormat {
+		case ReportFormatCSV:
+			return report.WriteCSV(os.Stdout)
+		case ReportFormatHTML:
+			return report.WriteHTML(os.Stdout)
+		}
+		jsonData, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(jsonData))
+		return nil
+	},
+}
+
+// BuildAccessReport reports on the subtree of collectionKey, or on every
+// collection when it is empty, and on the files with fileKeys.
+func BuildAccessReport(client *hiarc.APIClient, collectionKey string, fileKeys []string) (AccessReport, error) {
+	report := AccessReport{
+		Principals: []string{},
+		Rows:       []AccessReportRow{},
+		Summary:    AccessReportSummary{SingleUserFiles: []string{}, OrphanFiles: []string{}},
+	}
+
+	users, r, err := client.UserApi.GetAllUsers(context.Background())
+	if err != nil {
+		return report, NewAPIError("UserApi.GetAllUsers", r, err)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Key < users[j].Key })
+	for _, u := range users {
+		report.Principals = append(report.Principals, GranteeUser+":"+u.Key)
+	}
+
+	// access asks Hiarc, as each user, whether the user can read something.
+	access := func(canRead func(userKey string) (bool, error)) (map[string]string, error) {
+		access := map[string]string{}
+		for _, u := range users {
+			ok, err := canRead(u.Key)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				access[GranteeUser+":"+u.Key] = ReportCanRead
+			}
+		}
+		return access, nil
+	}
+
+	tree, err := loadAccessTree(client, "")
+	if err != nil {
+		return report, err
+	}
+	var scope []string
+	if collectionKey != "" {
+		if _, r, err := client.CollectionApi.GetCollection(context.Background(), collectionKey, &hiarc.GetCollectionOpts{}); err != nil {
+			return report, NewAPIError("CollectionApi.GetCollection", r, err)
+		}
+		scope = tree.subtree(collectionKey)
+	} else {
+		for k := range tree.collections {
+			scope = append(scope, k)
+		}
+		sort.Strings(scope)
+	}
+	for _, k := range scope {
+		a, err := access(func(userKey string) (bool, error) { return canReadCollection(client, userKey, k) })
+		if err != nil {
+			return report, err
+		}
+		report.Rows = append(report.Rows, AccessReportRow{Type: "collection", Key: k, Name: tree.collections[k].Name, Access: a})
+	}
+
+	files, err := NewFileWalker(client, "", scope, false).All()
+	if err != nil {
+		return report, err
+	}
+	seen := map[string]bool{}
+	for _, f := range files {
+		seen[f.Key] = true
+	}
+	for _, k := range fileKeys {
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		f, r, err := client.FileApi.GetFile(context.Background(), k, &hiarc.GetFileOpts{})
+		if err != nil {
+			return report, NewAPIError("FileApi.GetFile", r, err)
+		}
+		files = append(files, f)
+	}
+
+	for _, f := range files {
+		collections, r, err := client.FileApi.GetCollectionsForFile(context.Background(), f.Key, &hiarc.GetCollectionsForFileOpts{})
+		if err != nil {
+			return report, NewAPIError("FileApi.GetCollectionsForFile", r, err)
+		}
+		if len(collections) == 0 {
+			report.Summary.OrphanFiles = append(report.Summary.OrphanFiles, f.Key)
+		}
+		a, err := access(func(userKey string) (bool, error) { return canReadFile(client, userKey, f.Key) })
+		if err != nil {
+			return report, err
+		}
+		report.Rows = append(report.Rows, AccessReportRow{Type: "file", Key: f.Key, Name: f.Name, Access: a})
+		if len(a) == 1 {
+			report.Summary.SingleUserFiles = append(report.Summary.SingleUserFiles, f.Key)
+		}
+	}
+	return report, nil
+}
+
+// subtree returns key and the keys of every collection below it.
+func (t *accessTree) subtree(key string) []string {
+	children := map[string][]string{}
+	for child, parents := range t.parents {
+		for _, p := range parents {
+			children[p] = append(children[p], child)
+		}
+	}
+	keys := []string{}
+	seen := map[string]bool{}
+	queue := []string{key}
+	for len(queue) > 0 {
+		k := queue[0]
+		queue = queue[1:]
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		keys = append(keys, k)
+		sort.Strings(children[k])
+		queue = append(queue, children[k]...)
+	}
+	return keys
+}
+
+// WriteCSV writes the matrix, then the summary after an empty line.
+func (report AccessReport) WriteCSV(out io.Writer) error {
+	w := csv.NewWriter(out)
+	w.Write(append([]string{"type", "key", "name"}, report.Principals...))
+	for _, row := range report.Rows {
+		record := []string{row.Type, row.Key, row.Name}
+		for _, p := range report.Principals {
+			record = append(record, row.Access[p])
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	fmt.Fprintln(out)
+	w.Write([]string{"summary", "file"})
+	for _, s := range report.summaryItems() {
+		for _, k := range s.Files {
+			w.Write([]string{s.Title, k})
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+var accessReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Hiarc access report</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>Access report</h1>
+<table>
+<tr><th>Type</th><th>Key</th><th>Name</th>{{range .Report.Principals}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+<h2>Summary</h2>
+{{range .Summary}}<h3>{{.Title}} ({{len .Files}})</h3>
+<ul>
+{{range .Files}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`))
+
+// WriteHTML writes the report as a standalone HTML page.
+func (report AccessReport) WriteHTML(out io.Writer) error {
+	var rows [][]string
+	for _, row := range report.Rows {
+		cells := []string{row.Type, row.Key, row.Name}
+		for _, p := range report.Principals {
+			cells = append(cells, row.Access[p])
+		}
+		rows = append(rows, cells)
+	}
+	return accessReportTemplate.Execute(out, map[string]interface{}{
+		"Report":  report,
+		"Rows":    rows,
+		"Summary": report.summaryItems(),
+	})
+}
+
+type accessReportSummaryItem struct {
+	Title string
+	Files []string
+}
+
+func (report AccessReport) summaryItems() []accessReportSummaryItem {
+	return []accessReportSummaryItem{
+		{"Files only one user can read", report.Summary.SingleUserFiles},
+		{"Files in no collection", report.Summary.OrphanFiles},
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.AddCommand(reportAccessCmd)
+
+	reportAccessCmd.Flags().StringVar(&reportCollection, "collection", "", "Report on this collection and the collections below it")
+	reportAccessCmd.Flags().BoolVar(&reportAll, "all", false, "Report on every collection")
+	reportAccessCmd.Flags().StringArrayVar(&reportFiles, "file", make([]string, 0), "Also report on this file, to find files that aren't in any collection")
+	reportAccessCmd.Flags().StringVar(&reportFormat, "format", ReportFormatCSV, "Report format: csv, html or json")
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/antihax/optional"
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"github.com/spf13/cobra"
+)
+
+// ResourceKind names a kind of key that command arguments take.
+type ResourceKind string
+
+const (
+	ResourceUsers             ResourceKind = "users"
+	ResourceGroups            ResourceKind = "groups"
+	ResourceCollections       ResourceKind = "collections"
+	ResourceFiles             ResourceKind = "files"
+	ResourceClassifications   ResourceKind = "classifications"
+	ResourceRetentionPolicies ResourceKind = "retention-policies"
+	// Access levels and profiles aren't fetched from Hiarc.
+	ResourceAccessLevels ResourceKind = "access-levels"
+	ResourceProfiles     ResourceKind = "profiles"
+)
+
+// placeholderKinds maps the argument placeholders used in Use strings, such
+// as "[collection key]", to the kind of key they take.
+var placeholderKinds = []struct {
+	suffix string
+	kind   ResourceKind
+}{
+	{"user key", ResourceUsers},
+	{"group key", ResourceGroups},
+	{"collection key", ResourceCollections},
+	{"file key", ResourceFiles},
+	{"file keys", ResourceFiles},
+	{"classification key", ResourceClassifications},
+	{"retention policy key", ResourceRetentionPolicies},
+	{"access level", ResourceAccessLevels},
+	{"profile name", ResourceProfiles},
+}
+
+// ArgumentKind returns the kind of key the argument at index takes, reading
+// the placeholders of the command's Use string. A "[list of ...]" placeholder
+// repeats for every argument after it. Create and add commands take new
+// keys, so they have none.
+func ArgumentKind(cmd *cobra.Command, index int) (ResourceKind, bool) {
+	if cmd.Name() == "create" || cmd.Name() == "add" {
+		return "", false
+	}
+	var placeholders []string
+	use := cmd.Use
+	for {
+		start := strings.Index(use, "[")
+		end := strings.Index(use, "]")
+		if start < 0 || end < start {
+			break
+		}
+		placeholders = append(placeholders, use[start+1:end])
+		use = use[end+1:]
+	}
+	if len(placeholders) == 0 {
+		return "", false
+	}
+	p := placeholders[len(placeholders)-1]
+	if index < len(placeholders) {
+		p = placeholders[index]
+	} else if !strings.HasPrefix(p, "list of ") {
+		return "", false
+	}
+	for _, pk := range placeholderKinds {
+		if strings.HasSuffix(p, pk.suffix) {
+			return pk.kind, true
+		}
+	}
+	return "", false
+}
+
+// FetchResourceKeys lists the keys of every resource of a kind, sorted. Hiarc
+// has no endpoint to list files, so files are gathered from all collections.
+func FetchResourceKeys(client *hiarc.APIClient, asUser string, kind ResourceKind) ([]string, error) {
+	var keys []string
+	switch kind {
+	case ResourceAccessLevels:
+		return AccessLevels, nil
+	case ResourceProfiles:
+		return ProfileNames(), nil
+	case ResourceUsers:
+		users, r, err := client.UserApi.GetAllUsers(context.Background())
+		if err != nil {
+			return nil, NewAPIError("UserApi.GetAllUsers", r, err)
+		}
+		for _, u := range users {
+			keys = append(keys, u.Key)
+		}
+	case ResourceGroups:
+		groups, r, err := client.GroupApi.GetAllGroups(context.Background())
+		if err != nil {
+			return nil, NewAPIError("GroupApi.GetAllGroups", r, err)
+		}
+		for _, g := range groups {
+			keys = append(keys, g.Key)
+		}
+	case ResourceCollections:
+		opts := hiarc.GetAllCollectionsOpts{}
+		if asUser != "" {
+			opts.XHiarcUserKey = optional.NewString(asUser)
+		}
+		collections, r, err := client.CollectionApi.GetAllCollections(context.Background(), &opts)
+		if err != nil {
+			return nil, NewAPIError("CollectionApi.GetAllCollections", r, err)
+		}
+		for _, c := range collections {
+			keys = append(keys, c.Key)
+		}
+	case ResourceFiles:
+		files, err := AllCollectionFiles(client, asUser)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			keys = append(keys, f.Key)
+		}
+	case ResourceClassifications:
+		opts := hiarc.GetAllClassificationsOpts{}
+		if asUser != "" {
+			opts.XHiarcUserKey = optional.NewString(asUser)
+		}
+		cs, r, err := client.ClassificationApi.GetAllClassifications(context.Background(), &opts)
+		if err != nil {
+			return nil, NewAPIError("ClassificationApi.GetAllClassifications", r, err)
+		}
+		for _, c := range cs {
+			keys = append(keys, c.Key)
+		}
+	case ResourceRetentionPolicies:
+		rps, r, err := client.RetentionPolicyApi.GetAllRetentionPolicies(context.Background())
+		if err != nil {
+			return nil, NewAPIError("RetentionPolicyApi.GetAllRetentionPolicies", r, err)
+		}
+		for _, rp := range rps {
+			keys = append(keys, rp.Key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
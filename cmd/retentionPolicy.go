@@ -23,10 +23,6 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"log"
-	"os"
 
 	hiarc "github.com/hiarcdb/hiarc-go-sdk"
 	"github.com/spf13/cobra"
@@ -40,22 +36,23 @@ var (
 )
 
 var retentionCmd = &cobra.Command{
-	Use:   "retention-policy",
-	Short: "Retention Policy commands for Hiarc",
-	Run:   nil,
+	Use:     "retention-policy",
+	Aliases: []string{"retention"},
+	Short:   "Retention Policy commands for Hiarc",
+	Run:     nil,
 }
 
 var createRetentionCmd = &cobra.Command{
 	Use:   "create [retention policy key]",
 	Short: "Create Retention Policy with a key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		cr := hiarc.CreateRetentionPolicyRequest{Key: args[0]}
 		if retentionMetadata != "" {
 			md, err := ConvertMetadataStringToObject(retentionMetadata)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			cr.Metadata = md
 		}
@@ -68,11 +65,9 @@ var createRetentionCmd = &cobra.Command{
 
 		policy, r, err := hiarcClient.RetentionPolicyApi.CreateRetentionPolicy(context.Background(), cr)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `RetentionPolicyApi.CreateRetentionPolicy``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("RetentionPolicyApi.CreateRetentionPolicy", r, err)
 		}
-		jsonData, err := json.MarshalIndent(policy, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(policy)
 	},
 }
 
@@ -80,32 +75,28 @@ var getRetentionCmd = &cobra.Command{
 	Use:   "get [retention policy key]",
 	Short: "Get Retention Policy by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 
 		retention, r, err := hiarcClient.RetentionPolicyApi.GetRetentionPolicy(context.Background(), args[0])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `RetentionPolicyApi.GetRetentionPolicy``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("RetentionPolicyApi.GetRetentionPolicy", r, err)
 		}
-		jsonData, err := json.MarshalIndent(retention, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(retention)
 	},
 }
 
 var getAllPoliciesCmd = &cobra.Command{
 	Use:   "all",
 	Short: "Get all Retention Policies",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 
 		policies, r, err := hiarcClient.RetentionPolicyApi.GetAllRetentionPolicies(context.Background())
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `RetentionPolicyApi.GetAllRetentionPolicies``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("RetentionPolicyApi.GetAllRetentionPolicies", r, err)
 		}
-		jsonData, err := json.MarshalIndent(policies, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintList(cmd, NewSliceIterator(policies))
 	},
 }
 
@@ -113,14 +104,14 @@ var updateRetentionCmd = &cobra.Command{
 	Use:   "update [retention policy key]",
 	Short: "Update Retention Policy by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 
 		ur := hiarc.UpdateRetentionPolicyRequest{}
 		if retentionMetadata != "" {
 			md, err := ConvertMetadataStringToObject(retentionMetadata)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			ur.Metadata = md
 		}
@@ -132,35 +123,27 @@ var updateRetentionCmd = &cobra.Command{
 		}
 		retention, r, err := hiarcClient.RetentionPolicyApi.UpdateRetentionPolicy(context.Background(), args[0], ur)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `RetentionPolicyApi.UpdateRetentionPolicy``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("RetentionPolicyApi.UpdateRetentionPolicy", r, err)
 		}
-		jsonData, err := json.MarshalIndent(retention, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(retention)
 	},
 }
 
 var findRetentionCmd = &cobra.Command{
 	Use:   "find",
 	Short: "Find Retention Policy by query",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
-		queries := make([]map[string]interface{}, 0)
-		for i := range retentionQueries {
-			q, err := ConvertQueryToObject(retentionQueries[i])
-			if err != nil {
-				log.Fatal(err)
-			}
-			queries = append(queries, q)
+		queries, err := FindQuery(retentionQueries, whereFlag)
+		if err != nil {
+			return err
 		}
 		qr := hiarc.FindRetentionPoliciesRequest{Query: queries}
 		fr, r, err := hiarcClient.RetentionPolicyApi.FindRetentionPolicies(context.Background(), qr)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `RetentionPolicyApi.FindRetentionPolicies``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("RetentionPolicyApi.FindRetentionPolicies", r, err)
 		}
-		jsonData, err := json.MarshalIndent(fr, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintList(cmd, NewSliceIterator(fr))
 	},
 }
 
@@ -181,5 +164,7 @@ func init() {
 	updateRetentionCmd.Flags().StringVar(&retentionMetadata, "metadata", "", "Retention metadata")
 
 	findRetentionCmd.Flags().StringArrayVar(&retentionQueries, "query", make([]string, 0), "Retention query")
-	findRetentionCmd.MarkFlagRequired("query")
+	findRetentionCmd.Flags().StringVar(&whereFlag, "where", "", whereUse)
+	addListFlags(getAllPoliciesCmd)
+	addListFlags(findRetentionCmd)
 }
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/antihax/optional"
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"github.com/spf13/cobra"
+)
+
+const (
+	RetentionStatusRetained  = "retained"
+	RetentionStatusDeletable = "deletable"
+)
+
+var (
+	retentionReportCollection string
+	retentionReportWithin     time.Duration
+)
+
+// RetentionReportEntry is when a file may be deleted, going by the retention
+// policies applied to it.
+type RetentionReportEntry struct {
+	Key         string    `json:"key"`
+	Name        string    `json:"name"`
+	Policies    []string  `json:"policies"`
+	DeletableAt time.Time `json:"deletableAt"`
+	DaysLeft    int       `json:"daysLeft"`
+	Status      string    `json:"status"`
+}
+
+var retentionReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "List when files under retention policies may be deleted",
+	Long: `List the files under retention policies by the date they may be deleted,
+the earliest first. A file may be deleted once every policy applied to it
+has expired. Files in every collection are walked, or only those in the
+--collection subtree; Hiarc can't list files, so files outside of
+collections are left out.
+
+Hiarc has no endpoint to read the legal holds on a file, so files under
+legal hold can't be flagged; a hold still stops a deletable file from being
+deleted.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hiarcClient := ConfigureHiarcClient()
+		asUser, _ := rootCmd.Flags().GetString("as-user")
+		var walker *FileWalker
+		if retentionReportCollection != "" {
+			walker = NewFileWalker(hiarcClient, asUser, []string{retentionReportCollection}, true)
+		} else {
+			w, err := NewAllFilesWalker(hiarcClient, asUser)
+			if err != nil {
+				return err
+			}
+			walker = w
+		}
+		files, err := walker.All()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		entries := []RetentionReportEntry{}
+		for _, f := range files {
+			entry, ok, err := retentionEntry(hiarcClient, asUser, f, now)
+			if err != nil {
+				return err
+			}
+			if !ok || (retentionReportWithin > 0 && entry.DeletableAt.After(now.Add(retentionReportWithin))) {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].DeletableAt.Before(entries[j].DeletableAt) })
+		return PrintResult(entries)
+	},
+}
+
+// retentionEntry works out when f may be deleted, and returns false when no
+// retention policy is applied to it.
+func retentionEntry(client *hiarc.APIClient, asUser string, f hiarc.File, now time.Time) (RetentionReportEntry, bool, error) {
+	entry := RetentionReportEntry{Key: f.Key, Name: f.Name, Policies: []string{}}
+	opts := hiarc.GetRetentionPoliciesOpts{}
+	if asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(asUser)
+	}
+	applications, r, err := client.FileApi.GetRetentionPolicies(context.Background(), f.Key, &opts)
+	if err != nil {
+		return entry, false, NewAPIError("FileApi.GetRetentionPolicies", r, err)
+	}
+	if len(applications) == 0 {
+		return entry, false, nil
+	}
+	for _, a := range applications {
+		entry.Policies = append(entry.Policies, a.RetentionPolicy.Key)
+		expiresAt := a.ExpiresAt
+		if expiresAt.IsZero() {
+			expiresAt = a.AppliedAt.Add(time.Duration(a.RetentionPolicy.Seconds) * time.Second)
+		}
+		if expiresAt.After(entry.DeletableAt) {
+			entry.DeletableAt = expiresAt
+		}
+	}
+	sort.Strings(entry.Policies)
+
+	entry.Status = RetentionStatusDeletable
+	if entry.DeletableAt.After(now) {
+		entry.Status = RetentionStatusRetained
+		entry.DaysLeft = int(entry.DeletableAt.Sub(now).Hours()/24) + 1
+	}
+	return entry, true, nil
+}
+
+func init() {
+	retentionCmd.AddCommand(retentionReportCmd)
+
+	retentionReportCmd.Flags().StringVar(&retentionReportCollection, "collection", "", "Only report on files in this collection and the collections below it")
+	retentionReportCmd.Flags().DurationVar(&retentionReportWithin, "within", 0, "Only report files that may be deleted within this long, such as 720h")
+}
@@ -55,14 +55,17 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
+	SilenceErrors: true,
+	SilenceUsage:  true,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	RegisterCompletions()
 	if err := rootCmd.Execute(); err != nil {
-		log.Fatal(err)
-		os.Exit(1)
+		PrintError(err)
+		os.Exit(ExitCodeFor(err))
 	}
 }
 
@@ -77,6 +80,7 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&profileNameFlag, "profile", "default", "profile name for config (automatically set to \"default\")")
 	rootCmd.PersistentFlags().StringVar(&asUserFlag, "as-user", "", "user to impersonate")
 	rootCmd.PersistentFlags().StringVar(&tokenFlag, "token", "", "token to use to call Hiarc")
+	rootCmd.PersistentFlags().StringVarP(&outputFlag, "output", "o", OutputJSON, "output format: json, jsonl, yaml, table, csv, go-template=<template> or jsonpath=<expression>")
 	// viper.BindPFlag("cli_profile_setting", rootCmd.PersistentFlags().Lookup("profile"))
 
 	// Cobra also supports local flags, which will only run
@@ -86,6 +90,10 @@ func init() {
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
+	if shellActive {
+		// A shell session keeps the config it started with.
+		return
+	}
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
@@ -100,8 +108,11 @@ func initConfig() {
 
 	// viper.AutomaticEnv() // read in environment variables that match
 
-	// If a config file is found, read it in.
+	// If a config file is found, read it in. Without one only commands
+	// that don't call Hiarc, such as config init, can run.
 	if err := viper.ReadInConfig(); err != nil {
-		log.Fatal(err)
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			log.Fatal(err)
+		}
 	}
 }
@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/antihax/optional"
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+const rulesLong = `Rules classify new files as they are uploaded by file create, file
+upload-dir and sync. The rules file of a profile is set with
+"hiarc config set rules [profile name] [path]" and is a YAML document:
+
+  rules:
+    - name: contracts
+      match:
+        glob: ["*contract*"]
+        extension: [pdf, docx]
+        minSize: 1024
+        maxSize: 104857600
+        mimeType: ["application/pdf", "application/vnd.*"]
+        collection: [legal]
+        metadata:
+          department: legal
+      classifications: [confidential]
+      retentionPolicies: [seven-years]
+      metadata:
+        reviewed: false
+
+Every condition under match must hold for a rule to apply, and a condition
+with a list holds when any item does. Globs match the file name, or the
+path when they contain a slash. The MIME type is sniffed from the content.
+Sizes are in bytes. collection is the collection the file is uploaded into,
+so it never holds for file create, and metadata is the metadata passed with
+--metadata. Every rule that applies adds its classifications and retention
+policies, and its metadata is set unless a later rule or --metadata sets the
+same property.`
+
+var (
+	rulesPath           string
+	rulesTestCollection string
+	rulesTestMetadata   string
+)
+
+// Rules are the auto-classification rules of a profile.
+type Rules struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+type Rule struct {
+	Name              string                 `yaml:"name"`
+	Match             RuleMatch              `yaml:"match"`
+	Classifications   []string               `yaml:"classifications"`
+	RetentionPolicies []string               `yaml:"retentionPolicies"`
+	Metadata          map[string]interface{} `yaml:"metadata"`
+}
+
+type RuleMatch struct {
+	Glob       []string               `yaml:"glob"`
+	Extension  []string               `yaml:"extension"`
+	MinSize    int64                  `yaml:"minSize"`
+	MaxSize    int64                  `yaml:"maxSize"`
+	MimeType   []string               `yaml:"mimeType"`
+	Collection []string               `yaml:"collection"`
+	Metadata   map[string]interface{} `yaml:"metadata"`
+}
+
+// RuleInput describes a file about to be uploaded.
+type RuleInput struct {
+	Path       string
+	Name       string
+	Collection string
+	Metadata   map[string]interface{}
+}
+
+// RulesResult is what the rules do with a file.
+type RulesResult struct {
+	Path              string                 `json:"path"`
+	Name              string                 `json:"name"`
+	Size              int64                  `json:"size"`
+	MimeType          string                 `json:"mimeType"`
+	Collection        string                 `json:"collection,omitempty"`
+	Rules             []string               `json:"rules"`
+	Classifications   []string               `json:"classifications"`
+	RetentionPolicies []string               `json:"retentionPolicies"`
+	Metadata          map[string]interface{} `json:"metadata"`
+}
+
+// LoadRules reads a rules file.
+func LoadRules(p string) (*Rules, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var rules Rules
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, NewValidationError("Invalid rules file %s: %s", p, err.Error())
+	}
+	for i, r := range rules.Rules {
+		if r.Name == "" {
+			rules.Rules[i].Name = fmt.Sprintf("rule %d", i+1)
+		}
+		for _, g := range append(append([]string{}, r.Match.Glob...), r.Match.MimeType...) {
+			if _, err := path.Match(g, ""); err != nil {
+				return nil, NewValidationError("Invalid rules file %s: bad pattern %q in %s", p, g, rules.Rules[i].Name)
+			}
+		}
+		for j, ext := range r.Match.Extension {
+			rules.Rules[i].Match.Extension[j] = strings.ToLower(strings.TrimPrefix(ext, "."))
+		}
+	}
+	return &rules, nil
+}
+
+// ProfileRules loads the rules file set on the active profile, and returns
+// nil when none is set. A relative path is taken from the config directory.
+func ProfileRules() (*Rules, error) {
+	p := viper.GetString(fmt.Sprintf("%s.rules", ActiveProfile()))
+	if p == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(p) && viper.ConfigFileUsed() != "" {
+		p = filepath.Join(filepath.Dir(viper.ConfigFileUsed()), p)
+	}
+	return LoadRules(p)
+}
+
+// Evaluate works out the classifications, retention policies and metadata
+// defaults for in. Nil rules match nothing.
+func (rules *Rules) Evaluate(in RuleInput) (RulesResult, error) {
+	res := RulesResult{
+		Path:              in.Path,
+		Name:              in.Name,
+		Collection:        in.Collection,
+		Rules:             []string{},
+		Classifications:   []string{},
+		RetentionPolicies: []string{},
+		Metadata:          map[string]interface{}{},
+	}
+	if res.Name == "" {
+		res.Name = filepath.Base(in.Path)
+	}
+	fi, err := os.Stat(in.Path)
+	if err != nil {
+		return res, err
+	}
+	res.Size = fi.Size()
+	if res.MimeType, err = sniffMimeType(in.Path); err != nil {
+		return res, err
+	}
+	if rules == nil {
+		return res, nil
+	}
+
+	for _, r := range rules.Rules {
+		if !r.Match.matches(res, in) {
+			continue
+		}
+		res.Rules = append(res.Rules, r.Name)
+		for _, c := range r.Classifications {
+			if !containsString(res.Classifications, c) {
+				res.Classifications = append(res.Classifications, c)
+			}
+		}
+		for _, p := range r.RetentionPolicies {
+			if !containsString(res.RetentionPolicies, p) {
+				res.RetentionPolicies = append(res.RetentionPolicies, p)
+			}
+		}
+		for k, v := range r.Metadata {
+			res.Metadata[k] = v
+		}
+	}
+	return res, nil
+}
+
+func (m RuleMatch) matches(res RulesResult, in RuleInput) bool {
+	if len(m.Glob) > 0 {
+		name := res.Name
+		ok := false
+		for _, g := range m.Glob {
+			target := name
+			if strings.Contains(g, "/") {
+				target = filepath.ToSlash(in.Path)
+			}
+			if matched, _ := path.Match(g, target); matched {
+				ok = true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(res.Name), "."))
+	if len(m.Extension) > 0 && !containsString(m.Extension, ext) {
+		return false
+	}
+	if m.MinSize > 0 && res.Size < m.MinSize {
+		return false
+	}
+	if m.MaxSize > 0 && res.Size > m.MaxSize {
+		return false
+	}
+	if len(m.MimeType) > 0 {
+		ok := false
+		for _, t := range m.MimeType {
+			if matched, _ := path.Match(t, res.MimeType); matched {
+				ok = true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(m.Collection) > 0 && !containsString(m.Collection, in.Collection) {
+		return false
+	}
+	for k, v := range m.Metadata {
+		actual, ok := in.Metadata[k]
+		if !ok || fmt.Sprint(actual) != fmt.Sprint(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// sniffMimeType detects the MIME type of a file from its first 512 bytes,
+// without any parameters such as the charset.
+func sniffMimeType(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	t := http.DetectContentType(buf[:n])
+	if i := strings.Index(t, ";"); i >= 0 {
+		t = t[:i]
+	}
+	return t, nil
+}
+
+// WithMetadata returns the metadata defaults of the rules overridden by md.
+func (res RulesResult) WithMetadata(md map[string]interface{}) map[string]interface{} {
+	if len(res.Metadata) == 0 {
+		return md
+	}
+	merged := map[string]interface{}{}
+	for k, v := range res.Metadata {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[k] = v
+	}
+	return merged
+}
+
+// applyRules adds the classifications and retention policies in res to the
+// file with key. Those the file already has are skipped, so the rules can be
+// applied again to a file an earlier run didn't finish.
+func applyRules(client *hiarc.APIClient, asUser string, key string, res RulesResult) error {
+	for _, c := range res.Classifications {
+		if err := ClassifyFile(client, asUser, key, c); err != nil && !IsConflict(err) {
+			return err
+		}
+	}
+	for _, p := range res.RetentionPolicies {
+		opts := hiarc.AddRetentionPolicyToFileOpts{}
+		if asUser != "" {
+			opts.XHiarcUserKey = optional.NewString(asUser)
+		}
+		ar := hiarc.AddRetentionPolicyToFileRequest{RetentionPolicyKey: p}
+		if _, r, err := client.FileApi.AddRetentionPolicyToFile(context.Background(), key, ar, &opts); err != nil {
+			if apiErr := NewAPIError("FileApi.AddRetentionPolicyToFile", r, err); !IsConflict(apiErr) {
+				return apiErr
+			}
+		}
+	}
+	return nil
+}
+
+var rulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "Auto-classification rule commands",
+	Long:  rulesLong,
+	Run:   nil,
+}
+
+var testRulesCmd = &cobra.Command{
+	Use:   "test [local path]",
+	Short: "Show what the rules would do with a file",
+	Long: `Show which rules apply to a local file, and the classifications, retention
+policies and metadata they would give it when uploaded. The rules file of the
+profile is used, or the one passed with --rules.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var rules *Rules
+		var err error
+		if rulesPath != "" {
+			rules, err = LoadRules(rulesPath)
+		} else {
+			rules, err = ProfileRules()
+		}
+		if err != nil {
+			return err
+		}
+		if rules == nil {
+			return NewValidationError("No rules file is set on profile %s, set one with \"hiarc config set rules %s [path]\" or pass --rules", ActiveProfile(), ActiveProfile())
+		}
+		in := RuleInput{Path: args[0], Collection: rulesTestCollection}
+		if rulesTestMetadata != "" {
+			md, err := ConvertMetadataStringToObject(rulesTestMetadata)
+			if err != nil {
+				return err
+			}
+			in.Metadata = md
+		}
+		res, err := rules.Evaluate(in)
+		if err != nil {
+			return err
+		}
+		res.Metadata = res.WithMetadata(in.Metadata)
+		return PrintResult(res)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rulesCmd)
+	rulesCmd.AddCommand(testRulesCmd)
+
+	testRulesCmd.Flags().StringVar(&rulesPath, "rules", "", "Rules file to test instead of the profile's")
+	testRulesCmd.Flags().StringVar(&rulesTestCollection, "collection", "", "Collection the file would be uploaded into")
+	testRulesCmd.Flags().StringVar(&rulesTestMetadata, "metadata", "", "Metadata the file would be created with")
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRules = `rules:
+  - name: contracts
+    match:
+      glob: ["*contract*"]
+      extension: [.PDF, txt]
+    classifications: [confidential]
+    retentionPolicies: [seven-years]
+    metadata:
+      department: legal
+      reviewed: false
+  - match:
+      mimeType: ["text/*"]
+      maxSize: 100
+    classifications: [small-text, confidential]
+    metadata:
+      department: records
+  - name: legal uploads
+    match:
+      glob: ["legal/*"]
+      collection: [legal]
+      metadata:
+        source: scanner
+    retentionPolicies: [seven-years, scanned]
+`
+
+func writeTestFile(t *testing.T, dir string, name string, content string) string {
+	p := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestRulesEvaluate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hiarc-rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rules, err := LoadRules(writeTestFile(t, dir, "rules.yaml", testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules.Rules[1].Name != "rule 2" {
+		t.Errorf("unnamed rule is called %q, want %q", rules.Rules[1].Name, "rule 2")
+	}
+
+	contract := writeTestFile(t, dir, "contract-2020.txt", "signed by both parties")
+	res, err := rules.Evaluate(RuleInput{Path: contract})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Name != "contract-2020.txt" || res.Size != 22 || res.MimeType != "text/plain" {
+		t.Errorf("name, size and MIME type = %q, %d, %q", res.Name, res.Size, res.MimeType)
+	}
+	if want := []string{"contracts", "rule 2"}; !reflect.DeepEqual(res.Rules, want) {
+		t.Errorf("rules = %v, want %v", res.Rules, want)
+	}
+	if want := []string{"confidential", "small-text"}; !reflect.DeepEqual(res.Classifications, want) {
+		t.Errorf("classifications = %v, want %v", res.Classifications, want)
+	}
+	if want := []string{"seven-years"}; !reflect.DeepEqual(res.RetentionPolicies, want) {
+		t.Errorf("retention policies = %v, want %v", res.RetentionPolicies, want)
+	}
+	// A later rule wins, and --metadata wins over every rule.
+	if want := map[string]interface{}{"department": "records", "reviewed": false}; !reflect.DeepEqual(res.Metadata, want) {
+		t.Errorf("metadata = %v, want %v", res.Metadata, want)
+	}
+	md := res.WithMetadata(map[string]interface{}{"department": "sales"})
+	if want := map[string]interface{}{"department": "sales", "reviewed": false}; !reflect.DeepEqual(md, want) {
+		t.Errorf("metadata with --metadata = %v, want %v", md, want)
+	}
+
+	// The name passed for the upload is matched, not the local one.
+	res, err = rules.Evaluate(RuleInput{Path: contract, Name: "notes.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"rule 2"}; !reflect.DeepEqual(res.Rules, want) {
+		t.Errorf("rules with another name = %v, want %v", res.Rules, want)
+	}
+
+	large := writeTestFile(t, dir, "large.bin", strings.Repeat("\x00", 200))
+	res, err = rules.Evaluate(RuleInput{Path: large})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rules) != 0 || len(res.Classifications) != 0 || res.MimeType != "application/octet-stream" {
+		t.Errorf("large binary file matched %v with MIME type %s", res.Rules, res.MimeType)
+	}
+
+	scan := writeTestFile(t, dir, filepath.Join("legal", "scan.png"), "\x89PNG\r\n\x1a\n"+strings.Repeat("x", 200))
+	in := RuleInput{Path: filepath.Join("legal", "scan.png"), Collection: "legal", Metadata: map[string]interface{}{"source": "scanner"}}
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	res, err = rules.Evaluate(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"legal uploads"}; !reflect.DeepEqual(res.Rules, want) {
+		t.Errorf("rules for %s = %v, want %v", scan, res.Rules, want)
+	}
+	if want := []string{"seven-years", "scanned"}; !reflect.DeepEqual(res.RetentionPolicies, want) {
+		t.Errorf("retention policies = %v, want %v", res.RetentionPolicies, want)
+	}
+	for _, changed := range []RuleInput{
+		{Path: in.Path, Collection: "other", Metadata: in.Metadata},
+		{Path: in.Path, Collection: "legal", Metadata: map[string]interface{}{"source": "email"}},
+		{Path: in.Path, Collection: "legal"},
+	} {
+		res, err = rules.Evaluate(changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Rules) != 0 {
+			t.Errorf("rules for %+v = %v, want none", changed, res.Rules)
+		}
+	}
+}
+
+func TestRulesEvaluateWithoutRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hiarc-rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var rules *Rules
+	res, err := rules.Evaluate(RuleInput{Path: writeTestFile(t, dir, "a.txt", "hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rules) != 0 || res.MimeType != "text/plain" {
+		t.Errorf("nil rules gave %+v", res)
+	}
+	if _, err := rules.Evaluate(RuleInput{Path: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("Evaluate of a missing file succeeded, want an error")
+	}
+}
+
+func TestLoadRulesErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hiarc-rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"unknown field": "rules:\n  - name: a\n    match:\n      size: 10\n",
+		"bad glob":      "rules:\n  - name: a\n    match:\n      glob: [\"[\"]\n",
+	} {
+		_, err := LoadRules(writeTestFile(t, dir, "rules.yaml", content))
+		if err == nil {
+			t.Errorf("%s: LoadRules succeeded, want an error", name)
+			continue
+		}
+		if ExitCodeFor(err) != ExitValidation {
+			t.Errorf("%s: exit code = %d, want %d", name, ExitCodeFor(err), ExitValidation)
+		}
+	}
+}
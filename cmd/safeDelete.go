@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/antihax/optional"
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+)
+
+const (
+	DeleteStatusDeleted = "deleted"
+	DeleteStatusKept    = "kept"
+	DeleteStatusFailed  = "failed"
+	DeleteStatusPlanned = "planned"
+)
+
+// DeleteResult is what a recursive delete did with one file or collection.
+type DeleteResult struct {
+	Type   string `json:"type"`
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// FileProtection returns why the file with key can't be deleted yet: the
+// retention policies applied to it that haven't expired. Hiarc has no
+// endpoint to read the legal holds on a file, so those aren't checked here;
+// Hiarc refuses to delete held files itself.
+func FileProtection(client *hiarc.APIClient, asUser string, key string) ([]string, error) {
+	opts := hiarc.GetRetentionPoliciesOpts{}
+	if asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(asUser)
+	}
+	applications, r, err := client.FileApi.GetRetentionPolicies(context.Background(), key, &opts)
+	if err != nil {
+		return nil, NewAPIError("FileApi.GetRetentionPolicies", r, err)
+	}
+	now := time.Now()
+	var reasons []string
+	for _, a := range applications {
+		expiresAt := a.ExpiresAt
+		if expiresAt.IsZero() {
+			expiresAt = a.AppliedAt.Add(time.Duration(a.RetentionPolicy.Seconds) * time.Second)
+		}
+		if expiresAt.After(now) {
+			reasons = append(reasons, fmt.Sprintf("retention policy %s until %s", a.RetentionPolicy.Key, expiresAt.UTC().Format(time.RFC3339)))
+		}
+	}
+	sort.Strings(reasons)
+	return reasons, nil
+}
+
+// checkFileDeletable refuses to delete a file that is still retained.
+func checkFileDeletable(client *hiarc.APIClient, asUser string, key string) error {
+	reasons, err := FileProtection(client, asUser, key)
+	if err != nil {
+		return err
+	}
+	if len(reasons) > 0 {
+		return &HiarcError{
+			Operation: fmt.Sprintf("delete file %s", key),
+			Message:   fmt.Sprintf("file %s is protected by %s and can't be deleted yet", key, strings.Join(reasons, ", ")),
+			ExitCode:  ExitConflict,
+		}
+	}
+	return nil
+}
+
+// DeleteCollectionRecursive deletes the files in the collection key and in
+// the collections below it, then the collections left empty, deepest first.
+// Files still under retention and files that are also in collections outside
+// of the subtree are kept, and so are the collections holding them.
+// Collections that are also children of collections outside of the subtree
+// are kept with everything below them. With dryRun nothing is deleted.
+func DeleteCollectionRecursive(client *hiarc.APIClient, asUser string, key string, dryRun bool) ([]DeleteResult, error) {
+	getOpts := hiarc.GetCollectionOpts{}
+	if asUser != "" {
+		getOpts.XHiarcUserKey = optional.NewString(asUser)
+	}
+	if _, r, err := client.CollectionApi.GetCollection(context.Background(), key, &getOpts); err != nil {
+		return nil, NewAPIError("CollectionApi.GetCollection", r, err)
+	}
+	tree, err := loadAccessTree(client, asUser)
+	if err != nil {
+		return nil, err
+	}
+	below := tree.subtree(key)
+	inSubtree := map[string]bool{}
+	for _, c := range below {
+		inSubtree[c] = true
+	}
+
+	// Collections with a parent outside of the subtree stay, and so does
+	// everything below them.
+	results := []DeleteResult{}
+	shared := map[string]bool{}
+	for _, c := range below[1:] {
+		var outside []string
+		for _, p := range tree.parents[c] {
+			if !inSubtree[p] {
+				outside = append(outside, p)
+			}
+		}
+		if len(outside) == 0 {
+			continue
+		}
+		sort.Strings(outside)
+		results = append(results, DeleteResult{Type: "collection", Key: c, Status: DeleteStatusKept, Reason: "also in collection " + strings.Join(outside, ", ")})
+		for _, d := range tree.subtree(c) {
+			if !shared[d] && d != c {
+				results = append(results, DeleteResult{Type: "collection", Key: d, Status: DeleteStatusKept, Reason: "below collection " + c})
+			}
+			shared[d] = true
+		}
+	}
+	order := []string{}
+	seen := map[string]bool{}
+	for _, c := range below {
+		if !shared[c] {
+			order = append(order, c)
+			seen[c] = true
+		}
+	}
+
+	kept := map[string]bool{}
+	var keep func(collection string)
+	keep = func(collection string) {
+		if !seen[collection] || kept[collection] {
+			return
+		}
+		kept[collection] = true
+		for _, p := range tree.parents[collection] {
+			keep(p)
+		}
+	}
+	for c := range shared {
+		for _, p := range tree.parents[c] {
+			keep(p)
+		}
+	}
+
+	files, err := NewFileWalker(client, asUser, order, false).All()
+	if err != nil {
+		return results, err
+	}
+	for _, f := range files {
+		reasons, err := FileProtection(client, asUser, f.Key)
+		if err != nil {
+			return results, err
+		}
+		inside, outside, err := fileCollections(client, asUser, f.Key, seen)
+		if err != nil {
+			return results, err
+		}
+		if len(outside) > 0 {
+			reasons = append(reasons, "also in collection "+strings.Join(outside, ", "))
+		}
+		result := DeleteResult{Type: "file", Key: f.Key, Status: DeleteStatusKept, Reason: strings.Join(reasons, ", ")}
+		if len(reasons) == 0 {
+			result = deleteOne(client, asUser, "file", f.Key, dryRun)
+		}
+		if result.Status == DeleteStatusKept || result.Status == DeleteStatusFailed {
+			for _, c := range inside {
+				keep(c)
+			}
+		}
+		results = append(results, result)
+	}
+
+	for i := len(order) - 1; i >= 0; i-- {
+		c := order[i]
+		if kept[c] {
+			results = append(results, DeleteResult{Type: "collection", Key: c, Status: DeleteStatusKept, Reason: "holds files or collections that were kept"})
+			continue
+		}
+		results = append(results, deleteOne(client, asUser, "collection", c, dryRun))
+		if results[len(results)-1].Status == DeleteStatusFailed {
+			for _, p := range tree.parents[c] {
+				keep(p)
+			}
+		}
+	}
+	return results, nil
+}
+
+// fileCollections splits the collections holding a file into those in the
+// subtree being deleted and those outside of it.
+func fileCollections(client *hiarc.APIClient, asUser string, fileKey string, subtree map[string]bool) ([]string, []string, error) {
+	opts := hiarc.GetCollectionsForFileOpts{}
+	if asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(asUser)
+	}
+	collections, r, err := client.FileApi.GetCollectionsForFile(context.Background(), fileKey, &opts)
+	if err != nil {
+		return nil, nil, NewAPIError("FileApi.GetCollectionsForFile", r, err)
+	}
+	var inside, outside []string
+	for _, c := range collections {
+		if subtree[c.Key] {
+			inside = append(inside, c.Key)
+		} else {
+			outside = append(outside, c.Key)
+		}
+	}
+	sort.Strings(outside)
+	return inside, outside, nil
+}
+
+func deleteOne(client *hiarc.APIClient, asUser string, kind string, key string, dryRun bool) DeleteResult {
+	result := DeleteResult{Type: kind, Key: key, Status: DeleteStatusPlanned}
+	if dryRun {
+		return result
+	}
+	var err error
+	if kind == "file" {
+		opts := hiarc.DeleteFileOpts{}
+		if asUser != "" {
+			opts.XHiarcUserKey = optional.NewString(asUser)
+		}
+		_, r, e := client.FileApi.DeleteFile(context.Background(), key, &opts)
+		if e != nil {
+			err = NewAPIError("FileApi.DeleteFile", r, e)
+		}
+	} else {
+		opts := hiarc.DeleteCollectionOpts{}
+		if asUser != "" {
+			opts.XHiarcUserKey = optional.NewString(asUser)
+		}
+		_, r, e := client.CollectionApi.DeleteCollection(context.Background(), key, &opts)
+		if e != nil {
+			err = NewAPIError("CollectionApi.DeleteCollection", r, e)
+		}
+	}
+	if err != nil {
+		result.Status = DeleteStatusFailed
+		result.Reason = err.Error()
+	} else {
+		result.Status = DeleteStatusDeleted
+	}
+	log.Println(fmt.Sprintf("%s %s: %s", kind, key, result.Status))
+	return result
+}
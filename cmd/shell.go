@@ -0,0 +1,415 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const shellHistoryFileName = "history"
+
+// shellActive is set while a shell session runs, commands run inside it
+// keep the config that was read when the session started.
+var shellActive bool
+
+var shellCmd = &cobra.Command{
+	Use:   "shell",
+	Short: "Start an interactive session",
+	Long: `Start an interactive session that runs hiarc commands without the
+hiarc prefix, keeping one client for the whole session. Tab completes
+commands, flags and the keys of users, groups, collections, files,
+classifications and retention policies, which are fetched once and cached
+until a command changes something or refresh is run.
+
+Besides all hiarc commands the session understands:
+  profile [name]   switch to another profile, or list profiles
+  as-user [key]    impersonate a user, or stop impersonating
+  refresh          forget the cached keys
+  exit             leave the session, as does ctrl-d
+
+History is kept in ~/.hiarc/history.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asUser, _ := rootCmd.Flags().GetString("as-user")
+		s := &shell{
+			profile: ActiveProfile(),
+			asUser:  asUser,
+			keys:    map[ResourceKind][]string{},
+		}
+		historyPath := ""
+		if dir := NewDefaultHiarcConfig().GetConfigPath(); os.MkdirAll(dir, 0700) == nil {
+			historyPath = filepath.Join(dir, shellHistoryFileName)
+		}
+		s.editor = newLineEditor(historyPath, s.complete)
+		shellActive = true
+		defer func() { shellActive = false }()
+		return s.run()
+	},
+}
+
+type shell struct {
+	profile string
+	asUser  string
+	keys    map[ResourceKind][]string
+	editor  *lineEditor
+}
+
+func (s *shell) run() error {
+	fmt.Fprintf(os.Stderr, "Connected to profile %s (%s). Type help for commands, exit to leave.\n", s.profile, GetConfigUrlByProfile(s.profile))
+	for {
+		s.prepare()
+		line, err := s.editor.ReadLine(s.prompt())
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		args, err := SplitShellLine(line)
+		if err != nil {
+			PrintError(NewValidationError("%v", err))
+			continue
+		}
+		if !carriesSecret(args) {
+			s.editor.AddHistory(line)
+		}
+		if args[0] == "exit" || args[0] == "quit" {
+			return nil
+		}
+		if err := s.execute(args); err != nil {
+			PrintError(err)
+		}
+	}
+}
+
+func (s *shell) prompt() string {
+	if s.asUser != "" {
+		return fmt.Sprintf("hiarc [%s as %s] > ", s.profile, s.asUser)
+	}
+	return fmt.Sprintf("hiarc [%s] > ", s.profile)
+}
+
+// prepare resets every flag to its default, as flags keep the values of the
+// previous command otherwise, and applies the session's profile and user.
+func (s *shell) prepare() {
+	resetFlags(rootCmd)
+	rootCmd.PersistentFlags().Lookup("profile").Value.Set(s.profile)
+	rootCmd.PersistentFlags().Lookup("as-user").Value.Set(s.asUser)
+}
+
+func (s *shell) execute(args []string) error {
+	switch args[0] {
+	case "profile":
+		if len(args) == 1 {
+			for _, p := range ProfileNames() {
+				marker := " "
+				if p == s.profile {
+					marker = "*"
+				}
+				fmt.Printf("%s %s (%s)\n", marker, p, GetConfigUrlByProfile(p))
+			}
+			return nil
+		}
+		if viper.Get(args[1]) == nil {
+			return NewValidationError("Couldn't find a profile named %s", args[1])
+		}
+		s.profile = args[1]
+		s.keys = map[ResourceKind][]string{}
+		return nil
+	case "as-user":
+		s.asUser = ""
+		if len(args) > 1 {
+			s.asUser = args[1]
+		}
+		s.keys = map[ResourceKind][]string{}
+		return nil
+	case "refresh":
+		s.keys = map[ResourceKind][]string{}
+		return nil
+	case "shell":
+		return NewValidationError("Already in a shell")
+	}
+
+	rootCmd.SetArgs(args)
+	c, err := rootCmd.ExecuteC()
+	if !isReadOnlyCommand(c) {
+		s.keys = map[ResourceKind][]string{}
+	}
+	return err
+}
+
+// isReadOnlyCommand reports whether c only reads, so the cached keys are
+// still good after it ran.
+func isReadOnlyCommand(c *cobra.Command) bool {
+	if c == nil {
+		return false
+	}
+	for _, prefix := range []string{"get", "list", "find", "view", "all", "download", "help"} {
+		if strings.HasPrefix(c.Name(), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// complete returns the candidates for the last word of line.
+func (s *shell) complete(line string) ([]string, int) {
+	start := strings.LastIndex(line, " ") + 1
+	current := line[start:]
+	words, err := SplitShellLine(line[:start])
+	if err != nil {
+		return nil, start
+	}
+
+	var candidates []string
+	switch {
+	case len(words) == 0:
+		candidates = append(subcommandNames(rootCmd), "profile", "as-user", "refresh", "exit")
+	case words[0] == "profile" && len(words) == 1:
+		candidates = ProfileNames()
+	case words[0] == "as-user" && len(words) == 1:
+		candidates = s.resourceKeys(ResourceUsers)
+	default:
+		c := rootCmd
+		nargs := 0
+		var pending *pflag.Flag
+		for _, w := range words {
+			if pending != nil {
+				pending = nil
+				continue
+			}
+			if strings.HasPrefix(w, "-") && w != "-" {
+				if f := lookupFlag(c, w); f != nil && f.NoOptDefVal == "" && !strings.Contains(w, "=") {
+					pending = f
+				}
+				continue
+			}
+			if nargs == 0 {
+				if sub := findSubcommand(c, w); sub != nil {
+					c = sub
+					continue
+				}
+			}
+			nargs++
+		}
+		switch {
+		case pending != nil:
+			candidates = s.flagValues(pending)
+		case strings.HasPrefix(current, "-"):
+			candidates = flagNames(c)
+		default:
+			if nargs == 0 {
+				candidates = subcommandNames(c)
+			}
+			if kind, ok := ArgumentKind(c, nargs); ok {
+				candidates = append(candidates, s.resourceKeys(kind)...)
+			}
+		}
+	}
+
+	matches := []string{}
+	for _, c := range candidates {
+		if strings.HasPrefix(c, current) {
+			matches = append(matches, c)
+		}
+	}
+	sort.Strings(matches)
+	return matches, start
+}
+
+// resourceKeys returns the keys of a kind, fetching them the first time.
+func (s *shell) resourceKeys(kind ResourceKind) []string {
+	if keys, ok := s.keys[kind]; ok {
+		return keys
+	}
+	keys, err := FetchResourceKeys(ConfigureHiarcClient(), s.asUser, kind)
+	if err != nil {
+		return nil
+	}
+	s.keys[kind] = keys
+	return keys
+}
+
+func (s *shell) flagValues(f *pflag.Flag) []string {
+	switch f.Name {
+	case "profile":
+		return ProfileNames()
+	case "as-user":
+		return s.resourceKeys(ResourceUsers)
+	case "output":
+		return []string{OutputJSON, OutputJSONLines, OutputYAML, OutputTable, OutputCSV, OutputGoTemplate, OutputJSONPath}
+	}
+	return nil
+}
+
+func subcommandNames(c *cobra.Command) []string {
+	var names []string
+	for _, sub := range c.Commands() {
+		if sub.IsAvailableCommand() || sub.Name() == "help" {
+			names = append(names, sub.Name())
+		}
+	}
+	return names
+}
+
+func findSubcommand(c *cobra.Command, name string) *cobra.Command {
+	for _, sub := range c.Commands() {
+		if sub.Name() == name || sub.HasAlias(name) {
+			return sub
+		}
+	}
+	return nil
+}
+
+// commandFlagSets are the flags a command accepts, its own and inherited.
+func commandFlagSets(c *cobra.Command) []*pflag.FlagSet {
+	return []*pflag.FlagSet{c.Flags(), c.PersistentFlags(), c.InheritedFlags()}
+}
+
+func lookupFlag(c *cobra.Command, word string) *pflag.Flag {
+	name := strings.SplitN(strings.TrimLeft(word, "-"), "=", 2)[0]
+	for _, fs := range commandFlagSets(c) {
+		if strings.HasPrefix(word, "--") {
+			if f := fs.Lookup(name); f != nil {
+				return f
+			}
+		} else if len(name) == 1 {
+			if f := fs.ShorthandLookup(name); f != nil {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+func flagNames(c *cobra.Command) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, fs := range commandFlagSets(c) {
+		fs.VisitAll(func(f *pflag.Flag) {
+			if !f.Hidden && !seen[f.Name] {
+				seen[f.Name] = true
+				names = append(names, "--"+f.Name)
+			}
+		})
+	}
+	return names
+}
+
+// resetFlags sets every flag of c and its subcommands back to its default.
+func resetFlags(c *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if !resetSliceFlag(f) {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	c.Flags().VisitAll(reset)
+	c.PersistentFlags().VisitAll(reset)
+	for _, sub := range c.Commands() {
+		resetFlags(sub)
+	}
+}
+
+// resetSliceFlag resets string slice and array flags, which append to their
+// value instead of replacing it once they have been set.
+func resetSliceFlag(f *pflag.Flag) bool {
+	sv, ok := f.Value.(pflag.SliceValue)
+	if !ok {
+		return false
+	}
+	def := []string{}
+	if d := strings.Trim(f.DefValue, "[]"); d != "" {
+		def = strings.Split(d, ",")
+	}
+	sv.Replace(def)
+	return true
+}
+
+// carriesSecret tells whether a shell line passes an admin key or a token,
+// so that it is left out of the history.
+func carriesSecret(args []string) bool {
+	for i, a := range args {
+		if a == "--adminKey" || a == "--token" || strings.HasPrefix(a, "--adminKey=") || strings.HasPrefix(a, "--token=") {
+			return true
+		}
+		if a == "adminKey" && i > 0 && args[i-1] == "set" {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitShellLine splits a line into words the way a POSIX shell does, with
+// single quotes, double quotes and backslash escapes.
+func SplitShellLine(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			if quote == '"' && r != '"' && r != '\\' {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' {
+				escaped = true
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("line ends with a backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+func init() {
+	rootCmd.AddCommand(shellCmd)
+}
@@ -0,0 +1,729 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/antihax/optional"
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+	"github.com/spf13/cobra"
+)
+
+const defaultSyncStateName = ".hiarc-sync.json"
+
+// Sync directions.
+const (
+	SyncUp   = "up"
+	SyncDown = "down"
+	SyncBoth = "both"
+)
+
+// Conflict policies, used when a file changed both locally and in Hiarc.
+const (
+	ConflictSkip   = "skip"
+	ConflictLocal  = "local"
+	ConflictRemote = "remote"
+	ConflictNewer  = "newer"
+	ConflictFail   = "fail"
+)
+
+// Sync actions.
+const (
+	SyncActionCreate       = "create"
+	SyncActionAddVersion   = "add-version"
+	SyncActionDownload     = "download"
+	SyncActionDeleteLocal  = "delete-local"
+	SyncActionRemoveRemote = "remove-remote"
+	SyncActionConflict     = "conflict"
+)
+
+const (
+	SyncStatusPlanned = "planned"
+	SyncStatusDone    = "done"
+	SyncStatusSkipped = "skipped"
+	SyncStatusFailed  = "failed"
+)
+
+var (
+	syncDirection          string
+	syncConflict           string
+	syncDryRun             bool
+	syncDelete             bool
+	syncStatePath          string
+	syncKeyTemplate        string
+	syncCollectionTemplate string
+	syncStorageService     string
+)
+
+// SyncState is what sync remembers about each file after the last run.
+type SyncState struct {
+	Collection string                    `json:"collection"`
+	SyncedAt   time.Time                 `json:"syncedAt"`
+	Files      map[string]SyncStateEntry `json:"files"`
+}
+
+type SyncStateEntry struct {
+	Key           string    `json:"key"`
+	CollectionKey string    `json:"collectionKey"`
+	Size          int64     `json:"size"`
+	ModTime       time.Time `json:"modTime"`
+	SHA256        string    `json:"sha256"`
+	VersionCount  float32   `json:"versionCount"`
+}
+
+// SyncAction is one change sync made, or would make with --dry-run.
+type SyncAction struct {
+	Path   string `json:"path"`
+	Key    string `json:"key"`
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	local  *syncLocalFile
+	remote *collectionDownloadJob
+}
+
+type syncLocalFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+	sha256  string
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync [local directory] [collection key]",
+	Short: "Synchronize a local directory with a collection",
+	Long: `Synchronize a local directory with a collection and its child collections.
+Subdirectories map to child collections by name, the same way upload-dir and
+collection download lay them out. A state file in the directory records the
+key, size, modification time, SHA-256 and version count of each file at the
+last sync, so only files that changed since are transferred.
+
+With --direction up only local changes are sent to Hiarc, with down only
+changes in Hiarc are downloaded, and with both (the default) changes flow
+both ways. Files that changed on both sides are conflicts, resolved with
+--conflict. Deletions are only synchronized with --delete: files deleted
+locally are removed from their collection, files removed in Hiarc are
+deleted locally. A file deleted on one side and changed on the other since
+the last sync is a conflict; --conflict local or remote picks a side, and
+the other policies leave it alone. When the key of a new local file already
+exists in Hiarc with other content, the local file is added to it as a new
+version.
+
+The auto-classification rules of the profile are applied to the files sync
+creates in Hiarc; see "hiarc rules --help".`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, collectionKey := args[0], args[1]
+		switch syncDirection {
+		case SyncUp, SyncDown, SyncBoth:
+		default:
+			return NewValidationError("%s is not a valid direction. Choose from the following: %s, %s, or %s", syncDirection, SyncUp, SyncDown, SyncBoth)
+		}
+		switch syncConflict {
+		case ConflictSkip, ConflictLocal, ConflictRemote, ConflictNewer, ConflictFail:
+		default:
+			return NewValidationError("%s is not a valid conflict policy. Choose from the following: %s, %s, %s, %s, or %s", syncConflict, ConflictSkip, ConflictLocal, ConflictRemote, ConflictNewer, ConflictFail)
+		}
+		s, err := os.Stat(root)
+		if err != nil {
+			return err
+		}
+		if !s.IsDir() {
+			return NewValidationError("%s is not a directory", root)
+		}
+		fileKeys, err := NewKeyTemplate(syncKeyTemplate)
+		if err != nil {
+			return err
+		}
+		collectionKeys, err := NewKeyTemplate(syncCollectionTemplate)
+		if err != nil {
+			return err
+		}
+		statePath := syncStatePath
+		if statePath == "" {
+			statePath = filepath.Join(root, defaultSyncStateName)
+		}
+		state, err := LoadSyncState(statePath, collectionKey)
+		if err != nil {
+			return err
+		}
+		rules, err := ProfileRules()
+		if err != nil {
+			return err
+		}
+
+		hiarcClient := ConfigureHiarcClient()
+		asUser, _ := rootCmd.Flags().GetString("as-user")
+		sy := &syncer{
+			client:         hiarcClient,
+			asUser:         asUser,
+			root:           root,
+			collection:     collectionKey,
+			state:          state,
+			fileKeys:       fileKeys,
+			collectionKeys: collectionKeys,
+			uploader:       &dirUploader{client: hiarcClient, asUser: asUser, storageService: syncStorageService, rules: rules},
+		}
+		if err := sy.scan(statePath); err != nil {
+			return err
+		}
+		actions, err := sy.plan()
+		if err != nil {
+			return err
+		}
+
+		if syncDryRun {
+			return PrintResult(actions)
+		}
+		sy.apply(actions)
+		state.SyncedAt = time.Now().UTC()
+		if err := SaveSyncState(statePath, state); err != nil {
+			return err
+		}
+		if err := PrintResult(actions); err != nil {
+			return err
+		}
+		failed := 0
+		for _, a := range actions {
+			if a.Status == SyncStatusFailed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return NewPartialFailure(failed, len(actions), "sync actions failed")
+		}
+		return nil
+	},
+}
+
+type syncer struct {
+	client         *hiarc.APIClient
+	asUser         string
+	root           string
+	collection     string
+	state          *SyncState
+	fileKeys       *KeyTemplate
+	collectionKeys *KeyTemplate
+	uploader       *dirUploader
+
+	local   map[string]*syncLocalFile
+	remote  map[string]*collectionDownloadJob
+	dirKeys map[string]string
+}
+
+// scan lists the local directory and the collection tree, keyed by slash
+// separated paths relative to the directory.
+func (sy *syncer) scan(statePath string) error {
+	sy.local = map[string]*syncLocalFile{}
+	absState, _ := filepath.Abs(statePath)
+	err := filepath.Walk(sy.root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".hiarc-") {
+			return nil
+		}
+		if abs, _ := filepath.Abs(p); abs == absState {
+			return nil
+		}
+		rel, err := filepath.Rel(sy.root, p)
+		if err != nil {
+			return err
+		}
+		sy.local[filepath.ToSlash(rel)] = &syncLocalFile{path: p, size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sy.remote = map[string]*collectionDownloadJob{}
+	sy.dirKeys = map[string]string{}
+	getOpts := hiarc.GetCollectionOpts{}
+	if sy.asUser != "" {
+		getOpts.XHiarcUserKey = optional.NewString(sy.asUser)
+	}
+	_, r, err := sy.client.CollectionApi.GetCollection(context.Background(), sy.collection, &getOpts)
+	if err != nil {
+		apiErr := NewAPIError("CollectionApi.GetCollection", r, err)
+		if !IsNotFound(apiErr) || syncDirection == SyncDown {
+			return apiErr
+		}
+		// The collection is created when the first file is uploaded.
+		return nil
+	}
+	w := newCollectionWalker(sy.client, sy.asUser)
+	if err := w.walk(sy.collection, sy.root, []string{}); err != nil {
+		return err
+	}
+	for dir, key := range w.dirKeys {
+		rel, err := filepath.Rel(sy.root, dir)
+		if err != nil {
+			return err
+		}
+		sy.dirKeys[filepath.ToSlash(rel)] = key
+	}
+	for i := range w.jobs {
+		j := w.jobs[i]
+		rel, err := filepath.Rel(sy.root, j.localPath)
+		if err != nil {
+			return err
+		}
+		sy.remote[filepath.ToSlash(rel)] = &j
+	}
+	return nil
+}
+
+// plan compares both sides with the state of the last sync.
+func (sy *syncer) plan() ([]SyncAction, error) {
+	paths := map[string]bool{}
+	for p := range sy.local {
+		paths[p] = true
+	}
+	for p := range sy.remote {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	upOK := syncDirection != SyncDown
+	downOK := syncDirection != SyncUp
+	actions := []SyncAction{}
+	conflicts := []string{}
+	for _, p := range sorted {
+		l, rm := sy.local[p], sy.remote[p]
+		st, known := sy.state.Files[p]
+		a := SyncAction{Path: p, Status: SyncStatusPlanned, local: l, remote: rm}
+		if rm != nil {
+			a.Key = rm.file.Key
+		} else if known {
+			a.Key = st.Key
+		}
+
+		switch {
+		case l != nil && rm != nil:
+			var localChanged, remoteChanged bool
+			if known && st.Key == rm.file.Key {
+				changed, err := sy.localChanged(l, st)
+				if err != nil {
+					return nil, err
+				}
+				localChanged = changed
+				remoteChanged = rm.file.VersionCount != st.VersionCount
+			} else {
+				same, err := sy.sameContent(l, rm)
+				if err != nil {
+					return nil, err
+				}
+				if same {
+					if err := sy.record(p, l, rm.collectionKey, rm.file); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				localChanged, remoteChanged = true, true
+			}
+			switch {
+			case localChanged && remoteChanged && syncDirection == SyncBoth:
+				a.Action, a.Reason = sy.resolveConflict(l, rm)
+			case localChanged && upOK:
+				a.Action, a.Reason = SyncActionAddVersion, "changed locally"
+			case remoteChanged && downOK:
+				a.Action, a.Reason = SyncActionDownload, "changed in Hiarc"
+			case !localChanged && !remoteChanged:
+				// Refresh the modification time when only the timestamp changed.
+				if err := sy.record(p, l, rm.collectionKey, rm.file); err != nil {
+					return nil, err
+				}
+			}
+		case l != nil:
+			switch {
+			case !known && upOK:
+				a.Action, a.Reason = SyncActionCreate, "new local file"
+			case known && syncDelete && downOK:
+				changed, err := sy.localChanged(l, st)
+				if err != nil {
+					return nil, err
+				}
+				a.Action, a.Reason = SyncActionDeleteLocal, "removed in Hiarc"
+				if changed {
+					a.Action, a.Reason = resolveRemovalConflict(SyncActionCreate, SyncActionDeleteLocal, "changed locally, removed in Hiarc")
+				}
+			case known && syncDirection == SyncUp:
+				a.Action, a.Reason = SyncActionCreate, "removed in Hiarc"
+			}
+		case rm != nil:
+			switch {
+			case !known && downOK:
+				a.Action, a.Reason = SyncActionDownload, "new in Hiarc"
+			case known && syncDelete && upOK:
+				a.Action, a.Reason = SyncActionRemoveRemote, "deleted locally"
+				if st.Key != rm.file.Key || rm.file.VersionCount != st.VersionCount {
+					a.Action, a.Reason = resolveRemovalConflict(SyncActionRemoveRemote, SyncActionDownload, "deleted locally, changed in Hiarc")
+				}
+			case known && syncDirection == SyncDown:
+				a.Action, a.Reason = SyncActionDownload, "deleted locally"
+			}
+		}
+		if a.Action == SyncActionConflict {
+			conflicts = append(conflicts, p)
+		}
+		if a.Action != "" {
+			actions = append(actions, a)
+		}
+	}
+
+	// Forget files that are gone on both sides.
+	for p := range sy.state.Files {
+		if !paths[p] {
+			delete(sy.state.Files, p)
+		}
+	}
+
+	if len(conflicts) > 0 && syncConflict == ConflictFail {
+		return nil, &HiarcError{
+			Message:  fmt.Sprintf("%d files changed on both sides since the last sync: %s", len(conflicts), strings.Join(conflicts, ", ")),
+			ExitCode: ExitConflict,
+		}
+	}
+	return actions, nil
+}
+
+func (sy *syncer) resolveConflict(l *syncLocalFile, rm *collectionDownloadJob) (string, string) {
+	switch syncConflict {
+	case ConflictLocal:
+		return SyncActionAddVersion, "conflict, keeping local"
+	case ConflictRemote:
+		return SyncActionDownload, "conflict, keeping Hiarc"
+	case ConflictNewer:
+		if l.modTime.After(rm.file.ModifiedAt) {
+			return SyncActionAddVersion, "conflict, local is newer"
+		}
+		return SyncActionDownload, "conflict, Hiarc is newer"
+	}
+	return SyncActionConflict, "changed locally and in Hiarc"
+}
+
+// resolveRemovalConflict resolves a file deleted on one side and changed on
+// the other with --conflict: keepLocal or keepRemote is the action that keeps
+// the local or the Hiarc side. newer can't be told apart without both
+// files, so it is left as a conflict like skip.
+func resolveRemovalConflict(keepLocal string, keepRemote string, reason string) (string, string) {
+	switch syncConflict {
+	case ConflictLocal:
+		return keepLocal, "conflict, keeping local"
+	case ConflictRemote:
+		return keepRemote, "conflict, keeping Hiarc"
+	}
+	return SyncActionConflict, reason
+}
+
+// localChanged checks size and modification time first and only hashes the
+// file when they differ from the state.
+func (sy *syncer) localChanged(l *syncLocalFile, st SyncStateEntry) (bool, error) {
+	if l.size == st.Size && l.modTime.Equal(st.ModTime) {
+		l.sha256 = st.SHA256
+		return false, nil
+	}
+	sum, err := FileSHA256(l.path)
+	if err != nil {
+		return false, err
+	}
+	l.sha256 = sum
+	return sum != st.SHA256, nil
+}
+
+// sameContent compares a file that exists on both sides but isn't in the
+// state yet, for example after a collection download. It uses the checksum
+// stored on the file when there is one, and downloads the file otherwise.
+func (sy *syncer) sameContent(l *syncLocalFile, rm *collectionDownloadJob) (bool, error) {
+	if l.sha256 == "" {
+		sum, err := FileSHA256(l.path)
+		if err != nil {
+			return false, err
+		}
+		l.sha256 = sum
+	}
+	if sum, ok := storedChecksum(rm.file); ok {
+		return sum == l.sha256, nil
+	}
+
+	tmp, err := ioutil.TempFile("", "hiarc-sync-")
+	if err != nil {
+		return false, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := DownloadFileToPath(sy.client, rm.file.Key, sy.asUser, tmp.Name()); err != nil {
+		return false, err
+	}
+	remoteSum, err := FileSHA256(tmp.Name())
+	if err != nil {
+		return false, err
+	}
+	return remoteSum == l.sha256, nil
+}
+
+func (sy *syncer) apply(actions []SyncAction) {
+	for i := range actions {
+		a := &actions[i]
+		var err error
+		switch a.Action {
+		case SyncActionConflict:
+			a.Status = SyncStatusSkipped
+			log.Println(fmt.Sprintf("%s: conflict, skipped", a.Path))
+			continue
+		case SyncActionCreate:
+			err = sy.create(a)
+		case SyncActionAddVersion:
+			err = sy.addVersion(a)
+		case SyncActionDownload:
+			err = sy.download(a)
+		case SyncActionDeleteLocal:
+			if err = os.Remove(a.local.path); err == nil {
+				delete(sy.state.Files, a.Path)
+			}
+		case SyncActionRemoveRemote:
+			err = sy.removeRemote(a)
+		}
+		if err != nil {
+			a.Status = SyncStatusFailed
+			a.Error = err.Error()
+		} else {
+			a.Status = SyncStatusDone
+		}
+		log.Println(fmt.Sprintf("%s %s: %s", a.Action, a.Path, a.Status))
+	}
+}
+
+func (sy *syncer) create(a *SyncAction) error {
+	collectionKey, err := sy.ensureDir(path.Dir(a.Path))
+	if err != nil {
+		return err
+	}
+	key, err := sy.fileKeys.Key(sy.collection, a.Path)
+	if err != nil {
+		return err
+	}
+	a.Key = key
+	// The key can already exist, for example when the file was removed from
+	// the collection but not deleted, or when two paths give the same key.
+	// Linking it is only right when it has the local content.
+	if err := sy.replaceChanged(a, key); err != nil {
+		return err
+	}
+	j := uploadDirJob{localPath: a.local.path, relPath: a.Path, key: key, collectionKey: collectionKey}
+	if _, err := sy.uploader.uploadFile(j); err != nil {
+		return err
+	}
+	return sy.recordRemote(a.Path, a.local, collectionKey, key)
+}
+
+// replaceChanged adds the local file as a new version of an existing file
+// whose content differs. It does nothing when the file doesn't exist yet.
+func (sy *syncer) replaceChanged(a *SyncAction, key string) error {
+	opts := hiarc.GetFileOpts{}
+	if sy.asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(sy.asUser)
+	}
+	file, r, err := sy.client.FileApi.GetFile(context.Background(), key, &opts)
+	if err != nil {
+		if apiErr := NewAPIError("FileApi.GetFile", r, err); !IsNotFound(apiErr) {
+			return apiErr
+		}
+		return nil
+	}
+	same, err := sy.sameContent(a.local, &collectionDownloadJob{file: file})
+	if err != nil || same {
+		return err
+	}
+	log.Println(fmt.Sprintf("%s: file %s already exists with other content, adding a version", a.Path, key))
+	t := NewTransfer(sy.client, sy.asUser)
+	t.Progress = false
+	av := hiarc.AddVersionToFileRequest{Key: key, StorageService: syncStorageService}
+	_, err = t.AddVersion(key, a.local.path, path.Base(a.Path), av)
+	return err
+}
+
+// ensureDir returns the key of the collection for a local directory,
+// creating it and any missing parents from the collection key template.
+func (sy *syncer) ensureDir(rel string) (string, error) {
+	if key, ok := sy.dirKeys[rel]; ok {
+		return key, nil
+	}
+	if rel == "." {
+		if _, err := sy.uploader.ensureCollection(sy.collection, sy.collection, ""); err != nil {
+			return "", err
+		}
+		sy.dirKeys[rel] = sy.collection
+		return sy.collection, nil
+	}
+	parentKey, err := sy.ensureDir(path.Dir(rel))
+	if err != nil {
+		return "", err
+	}
+	key, err := sy.collectionKeys.Key(sy.collection, rel)
+	if err != nil {
+		return "", err
+	}
+	if _, err := sy.uploader.ensureCollection(key, path.Base(rel), parentKey); err != nil {
+		return "", err
+	}
+	sy.dirKeys[rel] = key
+	return key, nil
+}
+
+func (sy *syncer) addVersion(a *SyncAction) error {
+	t := NewTransfer(sy.client, sy.asUser)
+	t.Progress = false
+	av := hiarc.AddVersionToFileRequest{Key: a.Key, StorageService: syncStorageService}
+	file, err := t.AddVersion(a.Key, a.local.path, path.Base(a.Path), av)
+	if err != nil {
+		return err
+	}
+	return sy.record(a.Path, a.local, a.remote.collectionKey, file)
+}
+
+func (sy *syncer) download(a *SyncAction) error {
+	dest := filepath.Join(sy.root, filepath.FromSlash(a.Path))
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return err
+	}
+	// Download next to the destination so a failed download never leaves a
+	// partial file behind.
+	tmp := filepath.Join(filepath.Dir(dest), ".hiarc-download-"+filepath.Base(dest))
+	if err := DownloadFileToPath(sy.client, a.Key, sy.asUser, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return err
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		return err
+	}
+	l := &syncLocalFile{path: dest, size: info.Size(), modTime: info.ModTime()}
+	return sy.record(a.Path, l, a.remote.collectionKey, a.remote.file)
+}
+
+func (sy *syncer) removeRemote(a *SyncAction) error {
+	opts := hiarc.RemoveFileFromCollectionOpts{}
+	if sy.asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(sy.asUser)
+	}
+	_, r, err := sy.client.CollectionApi.RemoveFileFromCollection(context.Background(), a.remote.collectionKey, a.Key, &opts)
+	if err != nil {
+		return NewAPIError("CollectionApi.RemoveFileFromCollection", r, err)
+	}
+	delete(sy.state.Files, a.Path)
+	return nil
+}
+
+func (sy *syncer) recordRemote(p string, l *syncLocalFile, collectionKey string, key string) error {
+	opts := hiarc.GetFileOpts{}
+	if sy.asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(sy.asUser)
+	}
+	file, r, err := sy.client.FileApi.GetFile(context.Background(), key, &opts)
+	if err != nil {
+		return NewAPIError("FileApi.GetFile", r, err)
+	}
+	return sy.record(p, l, collectionKey, file)
+}
+
+// record stores both sides of a file as in sync.
+func (sy *syncer) record(p string, l *syncLocalFile, collectionKey string, file hiarc.File) error {
+	if l.sha256 == "" {
+		sum, err := FileSHA256(l.path)
+		if err != nil {
+			return err
+		}
+		l.sha256 = sum
+	}
+	sy.state.Files[p] = SyncStateEntry{
+		Key:           file.Key,
+		CollectionKey: collectionKey,
+		Size:          l.size,
+		ModTime:       l.modTime,
+		SHA256:        l.sha256,
+		VersionCount:  file.VersionCount,
+	}
+	return nil
+}
+
+// FileSHA256 returns the hex encoded SHA-256 of a local file.
+func FileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// LoadSyncState reads the state file, or returns an empty state when there
+// is none yet.
+func LoadSyncState(p string, collectionKey string) (*SyncState, error) {
+	state := &SyncState{Collection: collectionKey, Files: map[string]SyncStateEntry{}}
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("Invalid sync state %s: %v", p, err)
+	}
+	if state.Collection != collectionKey {
+		return nil, NewValidationError("%s was synced with collection %s, not %s", p, state.Collection, collectionKey)
+	}
+	if state.Files == nil {
+		state.Files = map[string]SyncStateEntry{}
+	}
+	return state, nil
+}
+
+func SaveSyncState(p string, state *SyncState) error {
+	jsonData, err := json.MarshalIndent(state, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, jsonData, 0644)
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+
+	syncCmd.Flags().StringVar(&syncDirection, "direction", SyncBoth, "Direction to synchronize: up, down or both")
+	syncCmd.Flags().StringVar(&syncConflict, "conflict", ConflictSkip, "What to do with files changed on both sides: skip, local, remote, newer or fail")
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "Print the planned changes without making them")
+	syncCmd.Flags().BoolVar(&syncDelete, "delete", false, "Synchronize deletions")
+	syncCmd.Flags().StringVar(&syncStatePath, "state", "", "Where to keep the sync state (default is "+defaultSyncStateName+" in the local directory)")
+	syncCmd.Flags().StringVar(&syncKeyTemplate, "key-template", defaultUploadKeyTemplate, "Go template used to derive keys for new files")
+	syncCmd.Flags().StringVar(&syncCollectionTemplate, "collection-key-template", defaultUploadKeyTemplate, "Go template used to derive keys for new subdirectories")
+	syncCmd.Flags().StringVar(&syncStorageService, "storage-service", "", "Service used to store files")
+	syncCmd.Flags().IntVar(&transferRetries, "retries", defaultRetries, transferRetriesUse)
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+)
+
+// syncFixture describes one path of a sync test: whether it exists locally,
+// whether it changed locally since the last sync, the version Hiarc has,
+// with 0 when it isn't in Hiarc, and whether the last sync recorded it.
+type syncFixture struct {
+	local         bool
+	localChanged  bool
+	remoteVersion float32
+	known         bool
+}
+
+var syncFixtures = map[string]syncFixture{
+	"new.txt":                {local: true},
+	"same.txt":               {local: true, remoteVersion: 1, known: true},
+	"edited.txt":             {local: true, localChanged: true, remoteVersion: 1, known: true},
+	"updated.txt":            {local: true, remoteVersion: 2, known: true},
+	"both.txt":               {local: true, localChanged: true, remoteVersion: 2, known: true},
+	"gone-remote.txt":        {local: true, known: true},
+	"gone-remote-edited.txt": {local: true, localChanged: true, known: true},
+	"gone-local.txt":         {remoteVersion: 1, known: true},
+	"gone-local-updated.txt": {remoteVersion: 2, known: true},
+	"remote-new.txt":         {remoteVersion: 1},
+	"gone-both.txt":          {known: true},
+}
+
+// newTestSyncer builds a syncer from syncFixtures, with the local files in
+// dir and the state as the last sync left it, when every file was at
+// version 1.
+func newTestSyncer(t *testing.T, dir string) *syncer {
+	sy := &syncer{
+		root:   dir,
+		state:  &SyncState{Files: map[string]SyncStateEntry{}},
+		local:  map[string]*syncLocalFile{},
+		remote: map[string]*collectionDownloadJob{},
+	}
+	for p, f := range syncFixtures {
+		key := "key-" + p
+		var entry SyncStateEntry
+		if f.local {
+			lp := filepath.Join(dir, p)
+			if err := ioutil.WriteFile(lp, []byte("now "+p), 0644); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(lp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sy.local[p] = &syncLocalFile{path: lp, size: info.Size(), modTime: info.ModTime()}
+			sum, err := FileSHA256(lp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entry = SyncStateEntry{Size: info.Size(), ModTime: info.ModTime(), SHA256: sum}
+			if f.localChanged {
+				entry = SyncStateEntry{Size: info.Size() + 1, ModTime: info.ModTime().Add(-time.Hour), SHA256: "before"}
+			}
+		}
+		if f.remoteVersion > 0 {
+			sy.remote[p] = &collectionDownloadJob{file: hiarc.File{Key: key, VersionCount: f.remoteVersion}, collectionKey: "c", localPath: filepath.Join(dir, p)}
+		}
+		if f.known {
+			entry.Key = key
+			entry.CollectionKey = "c"
+			entry.VersionCount = 1
+			sy.state.Files[p] = entry
+		}
+	}
+	return sy
+}
+
+func planActions(t *testing.T, direction string, conflict string, del bool) (map[string]string, *syncer, error) {
+	defer func(d string, c string, del bool) { syncDirection, syncConflict, syncDelete = d, c, del }(syncDirection, syncConflict, syncDelete)
+	syncDirection, syncConflict, syncDelete = direction, conflict, del
+
+	dir, err := ioutil.TempDir("", "hiarc-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sy := newTestSyncer(t, dir)
+	actions, err := sy.plan()
+	got := map[string]string{}
+	for _, a := range actions {
+		if a.Status != SyncStatusPlanned {
+			t.Errorf("%s is %s, want %s", a.Path, a.Status, SyncStatusPlanned)
+		}
+		got[a.Path] = a.Action
+	}
+	return got, sy, err
+}
+
+func TestSyncPlanBoth(t *testing.T) {
+	got, sy, err := planActions(t, SyncBoth, ConflictSkip, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"new.txt":                SyncActionCreate,
+		"edited.txt":             SyncActionAddVersion,
+		"updated.txt":            SyncActionDownload,
+		"both.txt":               SyncActionConflict,
+		"gone-remote.txt":        SyncActionDeleteLocal,
+		"gone-remote-edited.txt": SyncActionConflict,
+		"gone-local.txt":         SyncActionRemoveRemote,
+		"gone-local-updated.txt": SyncActionConflict,
+		"remote-new.txt":         SyncActionDownload,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("plan = %v, want %v", got, want)
+	}
+	if _, ok := sy.state.Files["gone-both.txt"]; ok {
+		t.Error("a file gone on both sides is still in the state")
+	}
+}
+
+func TestSyncPlanConflictPolicies(t *testing.T) {
+	got, _, err := planActions(t, SyncBoth, ConflictLocal, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]string{
+		"both.txt":               SyncActionAddVersion,
+		"gone-remote-edited.txt": SyncActionCreate,
+		"gone-local-updated.txt": SyncActionRemoveRemote,
+	} {
+		if got[p] != want {
+			t.Errorf("--conflict local: %s is %q, want %q", p, got[p], want)
+		}
+	}
+
+	got, _, err = planActions(t, SyncBoth, ConflictRemote, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]string{
+		"both.txt":               SyncActionDownload,
+		"gone-remote-edited.txt": SyncActionDeleteLocal,
+		"gone-local-updated.txt": SyncActionDownload,
+	} {
+		if got[p] != want {
+			t.Errorf("--conflict remote: %s is %q, want %q", p, got[p], want)
+		}
+	}
+
+	_, _, err = planActions(t, SyncBoth, ConflictFail, true)
+	if ExitCodeFor(err) != ExitConflict {
+		t.Errorf("--conflict fail: error = %v, want exit code %d", err, ExitConflict)
+	}
+}
+
+func TestSyncPlanOneWay(t *testing.T) {
+	got, _, err := planActions(t, SyncUp, ConflictSkip, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"new.txt":                SyncActionCreate,
+		"edited.txt":             SyncActionAddVersion,
+		"both.txt":               SyncActionAddVersion,
+		"gone-remote.txt":        SyncActionCreate,
+		"gone-remote-edited.txt": SyncActionCreate,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("up plan = %v, want %v", got, want)
+	}
+
+	got, _, err = planActions(t, SyncDown, ConflictSkip, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{
+		"updated.txt":            SyncActionDownload,
+		"both.txt":               SyncActionDownload,
+		"gone-local.txt":         SyncActionDownload,
+		"gone-local-updated.txt": SyncActionDownload,
+		"remote-new.txt":         SyncActionDownload,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("down plan = %v, want %v", got, want)
+	}
+}
+
+func TestSyncPlanRecordsMatchingUntrackedFile(t *testing.T) {
+	defer func(d string, c string) { syncDirection, syncConflict = d, c }(syncDirection, syncConflict)
+	syncDirection, syncConflict = SyncBoth, ConflictSkip
+
+	dir, err := ioutil.TempDir("", "hiarc-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lp := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(lp, []byte("same on both sides"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := FileSHA256(lp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(lp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := hiarc.File{Key: "a", VersionCount: 3, Metadata: map[string]interface{}{
+		ChecksumMetadataKey:        sum,
+		ChecksumVersionMetadataKey: float64(3),
+	}}
+	sy := &syncer{
+		root:   dir,
+		state:  &SyncState{Files: map[string]SyncStateEntry{}},
+		local:  map[string]*syncLocalFile{"a.txt": {path: lp, size: info.Size(), modTime: info.ModTime()}},
+		remote: map[string]*collectionDownloadJob{"a.txt": {file: file, collectionKey: "c", localPath: lp}},
+	}
+	actions, err := sy.plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 0 {
+		t.Errorf("plan = %v, want nothing to do", actions)
+	}
+	want := SyncStateEntry{Key: "a", CollectionKey: "c", Size: info.Size(), ModTime: info.ModTime(), SHA256: sum, VersionCount: 3}
+	if got := sy.state.Files["a.txt"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("state = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package cmd
+
+import "errors"
+
+type terminalState struct{}
+
+// makeRaw isn't supported here, the shell falls back to reading plain lines.
+func makeRaw(fd int) (*terminalState, error) {
+	return nil, errors.New("raw terminal mode isn't supported on this platform")
+}
+
+func restoreTerminal(fd int, state *terminalState) error {
+	return nil
+}
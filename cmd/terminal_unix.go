@@ -0,0 +1,37 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package cmd
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// terminalState holds the terminal settings to restore after raw mode.
+type terminalState struct {
+	termios unix.Termios
+}
+
+// makeRaw puts the terminal fd in raw mode, so keys such as tab and the
+// arrows are read as they are typed. Output processing is left on.
+func makeRaw(fd int) (*terminalState, error) {
+	termios, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, err
+	}
+	old := terminalState{termios: *termios}
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, termios); err != nil {
+		return nil, err
+	}
+	return &old, nil
+}
+
+func restoreTerminal(fd int, state *terminalState) error {
+	return unix.IoctlSetTermios(fd, ioctlWriteTermios, &state.termios)
+}
@@ -23,9 +23,6 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"os"
 
 	hiarc "github.com/hiarcdb/hiarc-go-sdk"
 	"github.com/spf13/cobra"
@@ -43,7 +40,7 @@ var createUserTokenCmd = &cobra.Command{
 	Use:   "create [user key]",
 	Short: "Create a token scoped to a specific user",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 
 		tr := hiarc.CreateUserTokenRequest{Key: args[0]}
@@ -53,11 +50,9 @@ var createUserTokenCmd = &cobra.Command{
 		}
 		token, r, err := hiarcClient.TokenApi.CreateUserToken(context.Background(), tr)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `TokenApi.CreateUserToken``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("TokenApi.CreateUserToken", r, err)
 		}
-		jsonData, err := json.MarshalIndent(token, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(token)
 	},
 }
 
@@ -0,0 +1,475 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/antihax/optional"
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+)
+
+// Metadata keys used to keep the checksum of the latest version on a file.
+const (
+	ChecksumMetadataKey        = "sha256"
+	ChecksumVersionMetadataKey = "sha256Version"
+)
+
+const (
+	retryBaseDelay     = 500 * time.Millisecond
+	retryMaxDelay      = 30 * time.Second
+	progressInterval   = 200 * time.Millisecond
+	defaultRetries     = 3
+	transferRetriesUse = "Number of times to retry a transfer after a transient failure"
+)
+
+var transferRetries int
+
+// Transfer streams file contents to and from Hiarc. It reports progress,
+// retries transient failures with exponential backoff and computes the
+// SHA-256 of the contents while they are transferred.
+type Transfer struct {
+	client   *hiarc.APIClient
+	asUser   string
+	Retries  int
+	Progress bool
+}
+
+// NewTransfer returns a Transfer that shows progress when stderr is a terminal.
+func NewTransfer(client *hiarc.APIClient, asUser string) *Transfer {
+	return &Transfer{
+		client:   client,
+		asUser:   asUser,
+		Retries:  transferRetries,
+		Progress: isTerminal(os.Stderr),
+	}
+}
+
+// CreateFile uploads localPath as a new file and stores its checksum. Before
+// retrying, it checks whether the failed attempt created the file after all.
+func (t *Transfer) CreateFile(localPath string, cf hiarc.CreateFileRequest) (hiarc.File, error) {
+	landed := func() (hiarc.File, bool, error) {
+		file, err := t.getFile(cf.Key)
+		if IsNotFound(err) {
+			return file, false, nil
+		}
+		return file, err == nil, err
+	}
+	file, sum, err := t.upload(http.MethodPost, "/files", "FileApi.CreateFile", cf, localPath, cf.Name, landed)
+	if err != nil {
+		return file, err
+	}
+	return t.storeChecksum(file, sum)
+}
+
+// AddVersion uploads localPath as a new version of a file and stores its
+// checksum. Before retrying, it checks whether the failed attempt added the
+// version after all.
+func (t *Transfer) AddVersion(key string, localPath string, name string, av hiarc.AddVersionToFileRequest) (hiarc.File, error) {
+	before, err := t.getFile(key)
+	if err != nil {
+		return before, err
+	}
+	landed := func() (hiarc.File, bool, error) {
+		file, err := t.getFile(key)
+		return file, err == nil && file.VersionCount > before.VersionCount, err
+	}
+	p := fmt.Sprintf("/files/%s/versions", neturl.QueryEscape(key))
+	file, sum, err := t.upload(http.MethodPut, p, "FileApi.AddVersion", av, localPath, name, landed)
+	if err != nil {
+		return file, err
+	}
+	return t.storeChecksum(file, sum)
+}
+
+func (t *Transfer) getFile(key string) (hiarc.File, error) {
+	opts := hiarc.GetFileOpts{}
+	if t.asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(t.asUser)
+	}
+	file, r, err := t.client.FileApi.GetFile(context.Background(), key, &opts)
+	if err != nil {
+		return file, NewAPIError("FileApi.GetFile", r, err)
+	}
+	return file, nil
+}
+
+// Download writes the latest version of a file to dest and verifies it
+// against the checksum stored on the file, if there is one for that version.
+func (t *Transfer) Download(key string, dest string) error {
+	p := fmt.Sprintf("/files/%s/download", neturl.QueryEscape(key))
+	return t.download(key, dest, "FileApi.DownloadFile", func() (*http.Request, error) {
+		return t.newRequest(http.MethodGet, p, nil)
+	})
+}
+
+// download writes to a temporary file next to dest and only renames it to
+// dest once it is complete and its checksum matches, so a failed download
+// never leaves a partial or corrupt file behind.
+func (t *Transfer) download(key string, dest string, operation string, newRequest func() (*http.Request, error)) error {
+	file, err := t.getFile(key)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(dest), ".hiarc-download-"+filepath.Base(dest))
+	defer os.Remove(tmp)
+
+	var sum string
+	err = t.retry(operation, func() error {
+		req, err := newRequest()
+		if err != nil {
+			return err
+		}
+		resp, err := t.client.GetConfig().HTTPClient.Do(req)
+		if err != nil {
+			return NewAPIError(operation, nil, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return errorFromResponse(operation, resp)
+		}
+
+		out, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		h := sha256.New()
+		pr := t.newProgress(file.Name, resp.ContentLength)
+		_, err = io.Copy(io.MultiWriter(out, h), pr.reader(resp.Body))
+		pr.finish()
+		if err != nil {
+			return NewAPIError(operation, nil, err)
+		}
+		sum = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if expected, ok := storedChecksum(file); ok && expected != sum {
+		return &HiarcError{
+			Operation: operation,
+			Message:   fmt.Sprintf("checksum mismatch for %s: expected sha256 %s, got %s", key, expected, sum),
+			ExitCode:  ExitError,
+		}
+	}
+	return os.Rename(tmp, dest)
+}
+
+// upload sends localPath with request. Uploads aren't idempotent, so before
+// each retry landed checks whether the failed attempt reached Hiarc anyway,
+// for example when only the response was lost, and if so returns the file
+// it made instead of uploading again.
+func (t *Transfer) upload(method string, p string, operation string, request interface{}, localPath string, name string, landed func() (hiarc.File, bool, error)) (hiarc.File, string, error) {
+	var file hiarc.File
+	var sum string
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return file, "", err
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return file, "", err
+	}
+	if name == "" {
+		name = info.Name()
+	}
+
+	attempts := 0
+	err = t.retry(operation, func() error {
+		attempts++
+		if attempts > 1 {
+			f, ok, err := landed()
+			if err != nil {
+				return err
+			}
+			if ok {
+				file = f
+				sum, err = FileSHA256(localPath)
+				return err
+			}
+		}
+		f, err := os.Open(localPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		// The body is streamed through a pipe, so the file is read only as
+		// fast as it is sent.
+		h := sha256.New()
+		progress := t.newProgress(name, info.Size())
+		pr, pw := io.Pipe()
+		defer pr.Close()
+		m := multipart.NewWriter(pw)
+		go func() {
+			pw.CloseWithError(writeUploadBody(m, jsonData, name, progress.reader(f), h))
+		}()
+
+		req, err := t.newRequest(method, p, pr)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", m.FormDataContentType())
+		err = t.do(req, operation, &file)
+		progress.finish()
+		if err != nil {
+			return err
+		}
+		sum = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	return file, sum, err
+}
+
+// writeUploadBody writes the multipart body Hiarc expects for uploads: the
+// request as JSON followed by the file contents.
+func writeUploadBody(m *multipart.Writer, jsonData []byte, name string, f io.Reader, h hash.Hash) error {
+	jsonHeader := textproto.MIMEHeader{}
+	jsonHeader.Set("Content-Type", "application/json")
+	jsonHeader.Set("Content-Disposition", `form-data; name="request"`)
+	part, err := m.CreatePart(jsonHeader)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(jsonData); err != nil {
+		return err
+	}
+
+	mediaHeader := textproto.MIMEHeader{}
+	mediaHeader.Set("Content-Type", "application/octet-stream")
+	mediaHeader.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, name))
+	mediaPart, err := m.CreatePart(mediaHeader)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.MultiWriter(mediaPart, h), f); err != nil {
+		return err
+	}
+	return m.Close()
+}
+
+// storeChecksum compares sum with a checksum Hiarc already has for the new
+// version, or saves it in the file's metadata for later verification.
+func (t *Transfer) storeChecksum(file hiarc.File, sum string) (hiarc.File, error) {
+	if expected, ok := storedChecksum(file); ok {
+		if expected != sum {
+			return file, &HiarcError{
+				Operation: "FileApi.UpdateFile",
+				Message:   fmt.Sprintf("checksum mismatch for %s: Hiarc has sha256 %s, uploaded %s", file.Key, expected, sum),
+				ExitCode:  ExitError,
+			}
+		}
+		return file, nil
+	}
+
+	md := map[string]interface{}{}
+	for k, v := range file.Metadata {
+		md[k] = v
+	}
+	md[ChecksumMetadataKey] = sum
+	md[ChecksumVersionMetadataKey] = file.VersionCount
+	opts := hiarc.UpdateFileOpts{}
+	if t.asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(t.asUser)
+	}
+	updated, r, err := t.client.FileApi.UpdateFile(context.Background(), file.Key, hiarc.UpdateFileRequest{Metadata: md}, &opts)
+	if err != nil {
+		return file, NewAPIError("FileApi.UpdateFile", r, err)
+	}
+	return updated, nil
+}
+
+// storedChecksum returns the checksum kept in the file's metadata when it
+// belongs to the file's latest version.
+func storedChecksum(file hiarc.File) (string, bool) {
+	sum, ok := file.Metadata[ChecksumMetadataKey].(string)
+	if !ok {
+		return "", false
+	}
+	version, ok := file.Metadata[ChecksumVersionMetadataKey].(float64)
+	if !ok || float32(version) != file.VersionCount {
+		return "", false
+	}
+	return sum, true
+}
+
+func (t *Transfer) newRequest(method string, p string, body io.Reader) (*http.Request, error) {
+	cfg := t.client.GetConfig()
+	req, err := http.NewRequest(method, cfg.BasePath+p, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", cfg.UserAgent)
+	for k, v := range cfg.DefaultHeader {
+		req.Header.Set(k, v)
+	}
+	if t.asUser != "" {
+		req.Header.Set("X-Hiarc-User-Key", t.asUser)
+	}
+	return req, nil
+}
+
+// do sends req and decodes the JSON response into v.
+func (t *Transfer) do(req *http.Request, operation string, v interface{}) error {
+	resp, err := t.client.GetConfig().HTTPClient.Do(req)
+	if err != nil {
+		return NewAPIError(operation, nil, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errorFromResponse(operation, resp)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return NewAPIError(operation, nil, err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return &HiarcError{Operation: operation, StatusCode: resp.StatusCode, Message: err.Error(), ExitCode: ExitError, Err: err}
+	}
+	return nil
+}
+
+func errorFromResponse(operation string, resp *http.Response) *HiarcError {
+	body, _ := ioutil.ReadAll(resp.Body)
+	return &HiarcError{
+		Operation:  operation,
+		StatusCode: resp.StatusCode,
+		Message:    messageFromBody(body),
+		ExitCode:   ExitCodeForStatus(resp.StatusCode),
+	}
+}
+
+// retry runs fn until it succeeds, fails with an error that isn't
+// transient, or runs out of retries.
+func (t *Transfer) retry(operation string, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= t.Retries || !isTransient(err) {
+			return err
+		}
+		delay := retryBaseDelay << uint(attempt)
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+		delay += time.Duration(rand.Int63n(int64(delay) / 2))
+		log.Println(fmt.Sprintf("%v, retrying in %s (%d of %d)", err, delay.Round(time.Millisecond), attempt+1, t.Retries))
+		time.Sleep(delay)
+	}
+}
+
+// isTransient reports whether a failed transfer is worth retrying.
+func isTransient(err error) bool {
+	he, ok := err.(*HiarcError)
+	if !ok {
+		return false
+	}
+	switch he.StatusCode {
+	case 0:
+		return he.ExitCode == ExitNetwork
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// transferProgress draws a single progress line on stderr.
+type transferProgress struct {
+	name    string
+	total   int64
+	n       int64
+	start   time.Time
+	last    time.Time
+	enabled bool
+}
+
+func (t *Transfer) newProgress(name string, total int64) *transferProgress {
+	return &transferProgress{name: name, total: total, start: time.Now(), enabled: t.Progress}
+}
+
+func (p *transferProgress) reader(r io.Reader) io.Reader {
+	if !p.enabled {
+		return r
+	}
+	return &progressReader{r: r, p: p}
+}
+
+func (p *transferProgress) add(n int) {
+	p.n += int64(n)
+	if now := time.Now(); now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.draw()
+	}
+}
+
+func (p *transferProgress) draw() {
+	elapsed := time.Since(p.start).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(p.n) / elapsed
+	}
+	line := fmt.Sprintf("%s  %s", p.name, formatBytes(p.n))
+	if p.total > 0 {
+		line += fmt.Sprintf(" / %s (%d%%)", formatBytes(p.total), p.n*100/p.total)
+	}
+	line += fmt.Sprintf("  %s/s", formatBytes(int64(rate)))
+	if p.total > 0 && rate > 0 && p.n < p.total {
+		eta := time.Duration(float64(p.total-p.n)/rate) * time.Second
+		line += fmt.Sprintf("  ETA %s", eta)
+	}
+	fmt.Fprintf(os.Stderr, "\r%-79s", line)
+}
+
+func (p *transferProgress) finish() {
+	if !p.enabled {
+		return
+	}
+	p.draw()
+	fmt.Fprintln(os.Stderr)
+}
+
+type progressReader struct {
+	r io.Reader
+	p *transferProgress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.p.add(n)
+	return n, err
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/antihax/optional"
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+)
+
+const directOperation = "direct transfer"
+
+// DirectUpload uploads localPath straight to the storage service through a
+// presigned URL from Hiarc, then attaches the stored object to the file key.
+// When the key already exists the attached object is expected to become a
+// new version, and the version count is checked to make sure it did.
+func (t *Transfer) DirectUpload(key string, localPath string, name string, storageService string) (hiarc.File, error) {
+	var file hiarc.File
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return file, err
+	}
+	before, err := t.getFile(key)
+	exists := err == nil
+	if err != nil && !IsNotFound(err) {
+		return file, err
+	}
+	if name == "" {
+		name = info.Name()
+	}
+
+	opts := hiarc.CreateDirectUploadUrlOpts{}
+	if t.asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(t.asUser)
+	}
+	du, r, err := t.client.FileApi.CreateDirectUploadUrl(context.Background(), hiarc.CreateDirectUploadUrlRequest{StorageService: storageService}, &opts)
+	if err != nil {
+		return file, NewAPIError("FileApi.CreateDirectUploadUrl", r, err)
+	}
+
+	var sum string
+	err = t.retry(directOperation, func() error {
+		f, err := os.Open(localPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		progress := t.newProgress(name, info.Size())
+		req, err := http.NewRequest(http.MethodPut, du.DirectUploadUrl, progress.reader(io.TeeReader(f, h)))
+		if err != nil {
+			return err
+		}
+		// Storage services need the length up front, they don't accept
+		// chunked uploads to presigned URLs.
+		req.ContentLength = info.Size()
+		req.Header.Set("Content-Type", "application/octet-stream")
+		if strings.Contains(req.URL.Host, ".blob.core.windows.net") {
+			req.Header.Set("x-ms-blob-type", "BlockBlob")
+		}
+		resp, err := t.client.GetConfig().HTTPClient.Do(req)
+		progress.finish()
+		if err != nil {
+			return NewAPIError(directOperation, nil, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return errorFromResponse(directOperation, resp)
+		}
+		sum = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return file, err
+	}
+
+	attachOpts := hiarc.AttachToExisitingFileOpts{}
+	if t.asUser != "" {
+		attachOpts.XHiarcUserKey = optional.NewString(t.asUser)
+	}
+	ar := hiarc.AttachToExistingFileRequest{Name: name, StorageService: du.StorageService, StorageId: du.StorageId}
+	if _, r, err := t.client.FileApi.AttachToExisitingFile(context.Background(), key, ar, &attachOpts); err != nil {
+		return file, NewAPIError("FileApi.AttachToExisitingFile", r, err)
+	}
+	file, err = t.getFile(key)
+	if err != nil {
+		return file, err
+	}
+	if exists && file.VersionCount <= before.VersionCount {
+		return file, &HiarcError{
+			Operation: "FileApi.AttachToExisitingFile",
+			Message:   fmt.Sprintf("Hiarc didn't add a version to %s, upload the version without --direct", key),
+			ExitCode:  ExitError,
+		}
+	}
+	return t.storeChecksum(file, sum)
+}
+
+// DirectDownload downloads the latest version of a file straight from the
+// storage service through a presigned URL from Hiarc.
+func (t *Transfer) DirectDownload(key string, dest string) error {
+	opts := hiarc.GetDirectDownloadUrlOpts{}
+	if t.asUser != "" {
+		opts.XHiarcUserKey = optional.NewString(t.asUser)
+	}
+	dd, r, err := t.client.FileApi.GetDirectDownloadUrl(context.Background(), key, &opts)
+	if err != nil {
+		return NewAPIError("FileApi.GetDirectDownloadUrl", r, err)
+	}
+	return t.download(key, dest, directOperation, func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, dd.DirectDownloadUrl, nil)
+	})
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	hiarc "github.com/hiarcdb/hiarc-go-sdk"
+)
+
+// fakeDirectHiarc stands in for Hiarc and a storage service. addsVersion
+// decides whether attaching to an existing key adds a version.
+type fakeDirectHiarc struct {
+	mu          sync.Mutex
+	files       map[string]*hiarc.File
+	stored      []byte
+	addsVersion bool
+}
+
+func (f *fakeDirectHiarc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	reply := func(status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+
+	switch {
+	case r.Method == http.MethodPut && parts[0] == "bucket":
+		f.stored = body
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPost && r.URL.Path == "/files/directuploadurl":
+		reply(http.StatusOK, hiarc.FileDirectUpload{DirectUploadUrl: "http://" + r.Host + "/bucket/object-1", StorageId: "object-1", StorageService: "fake"})
+	case len(parts) == 3 && parts[2] == "attach":
+		file, ok := f.files[parts[1]]
+		if !ok {
+			file = &hiarc.File{Key: parts[1], VersionCount: 1}
+			f.files[parts[1]] = file
+		} else if f.addsVersion {
+			file.VersionCount++
+		}
+		reply(http.StatusOK, file)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		file, ok := f.files[parts[1]]
+		if !ok {
+			reply(http.StatusNotFound, map[string]string{"message": "not found"})
+			return
+		}
+		reply(http.StatusOK, file)
+	case len(parts) == 2 && r.Method == http.MethodPut:
+		var uf hiarc.UpdateFileRequest
+		json.Unmarshal(body, &uf)
+		file := f.files[parts[1]]
+		file.Metadata = uf.Metadata
+		reply(http.StatusOK, file)
+	default:
+		reply(http.StatusNotFound, map[string]string{"message": "unexpected " + r.Method + " " + r.URL.Path})
+	}
+}
+
+// directUpload uploads content through a Transfer talking to fake.
+func directUpload(t *testing.T, fake *fakeDirectHiarc, key string, content string) (hiarc.File, error) {
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "hiarc-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "upload.txt")
+	if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tr := &Transfer{client: ConfigureHiarcClientWithValues(server.URL, "key")}
+	return tr.DirectUpload(key, p, "", "")
+}
+
+func TestDirectUploadCreatesFile(t *testing.T) {
+	fake := &fakeDirectHiarc{files: map[string]*hiarc.File{}}
+	file, err := directUpload(t, fake, "file-1", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fake.stored) != "hello" {
+		t.Errorf("stored %q, want %q", fake.stored, "hello")
+	}
+	if file.VersionCount != 1 {
+		t.Errorf("version count %v, want 1", file.VersionCount)
+	}
+	if _, ok := storedChecksum(file); !ok {
+		t.Errorf("checksum wasn't stored: %v", file.Metadata)
+	}
+}
+
+func TestDirectUploadAddsVersion(t *testing.T) {
+	fake := &fakeDirectHiarc{files: map[string]*hiarc.File{"file-1": {Key: "file-1", VersionCount: 1}}, addsVersion: true}
+	file, err := directUpload(t, fake, "file-1", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.VersionCount != 2 {
+		t.Errorf("version count %v, want 2", file.VersionCount)
+	}
+}
+
+func TestDirectUploadFailsWhenNoVersionIsAdded(t *testing.T) {
+	fake := &fakeDirectHiarc{files: map[string]*hiarc.File{"file-1": {Key: "file-1", VersionCount: 1}}}
+	_, err := directUpload(t, fake, "file-1", "second")
+	if err == nil || !strings.Contains(err.Error(), "didn't add a version") {
+		t.Fatalf("got error %v, want one saying no version was added", err)
+	}
+}
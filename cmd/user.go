@@ -23,10 +23,9 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os"
 
 	hiarc "github.com/hiarcdb/hiarc-go-sdk"
 	"github.com/antihax/optional"
@@ -52,13 +51,13 @@ var createUserCmd = &cobra.Command{
 	Use:   "create [user key]",
 	Short: "Create user with a key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		cu := hiarc.CreateUserRequest{Key: args[0]}
 		if userMetadata != "" {
 			md, err := ConvertMetadataStringToObject(userMetadata)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			cu.Metadata = md
 		}
@@ -71,11 +70,9 @@ var createUserCmd = &cobra.Command{
 
 		user, r, err := hiarcClient.UserApi.CreateUser(context.Background(), cu)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `UserApi.CreateUser``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("UserApi.CreateUser", r, err)
 		}
-		jsonData, err := json.MarshalIndent(user, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(user)
 	},
 }
 
@@ -83,32 +80,28 @@ var getUserCmd = &cobra.Command{
 	Use:   "get [user key]",
 	Short: "Get user by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 
 		user, r, err := hiarcClient.UserApi.GetUser(context.Background(), args[0])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `UserApi.GetUser``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("UserApi.GetUser", r, err)
 		}
-		jsonData, err := json.MarshalIndent(user, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(user)
 	},
 }
 
 var getAllUsersCmd = &cobra.Command{
 	Use:   "all",
 	Short: "Get all users",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 
 		user, r, err := hiarcClient.UserApi.GetAllUsers(context.Background())
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `UserApi.GetUser``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("UserApi.GetAllUsers", r, err)
 		}
-		jsonData, err := json.MarshalIndent(user, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintList(cmd, NewSliceIterator(user))
 	},
 }
 
@@ -116,14 +109,14 @@ var updateUserCmd = &cobra.Command{
 	Use:   "update [user key]",
 	Short: "Update user by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 
 		uu := hiarc.UpdateUserRequest{}
 		if userMetadata != "" {
 			md, err := ConvertMetadataStringToObject(userMetadata)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			uu.Metadata = md
 		}
@@ -135,11 +128,9 @@ var updateUserCmd = &cobra.Command{
 		}
 		user, r, err := hiarcClient.UserApi.UpdateUser(context.Background(), args[0], uu)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `UserApi.Update``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("UserApi.UpdateUser", r, err)
 		}
-		jsonData, err := json.MarshalIndent(user, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(user)
 	},
 }
 
@@ -147,45 +138,42 @@ var deleteUserCmd = &cobra.Command{
 	Use:   "delete [user key]",
 	Short: "Delete user by key",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := ConfirmDestructive(fmt.Sprintf("delete user %s", args[0])); err != nil {
+			return err
+		}
 		hiarcClient := ConfigureHiarcClient()
 		_, r, err := hiarcClient.UserApi.DeleteUser(context.Background(), args[0])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `UserApi.GetUser``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("UserApi.DeleteUser", r, err)
 		}
 		log.Println(fmt.Sprintf("Deleted user: %s", args[0]))
+		return nil
 	},
 }
 
 var findUserCmd = &cobra.Command{
 	Use:   "find",
 	Short: "Find user by query",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
-		queries := make([]map[string]interface{}, 0)
-		for i := range userQueries {
-			q, err := ConvertQueryToObject(userQueries[i])
-			if err != nil {
-				log.Fatal(err)
-			}
-			queries = append(queries, q)
+		queries, err := FindQuery(userQueries, whereFlag)
+		if err != nil {
+			return err
 		}
 		qr := hiarc.FindUsersRequest{Query: queries}
 		fu, r, err := hiarcClient.UserApi.FindUser(context.Background(), qr)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `UserApi.Update``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("UserApi.FindUser", r, err)
 		}
-		jsonData, err := json.MarshalIndent(fu, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintList(cmd, NewSliceIterator(fu))
 	},
 }
 
 var getCurrentUserCmd = &cobra.Command{
 	Use:   "current",
 	Short: "Get the current",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.GetCurrentUserOpts{}
@@ -195,38 +183,34 @@ var getCurrentUserCmd = &cobra.Command{
 
 		user, r, err := hiarcClient.UserApi.GetCurrentUser(context.Background(), &opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `UserApi.GetUser``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("UserApi.GetCurrentUser", r, err)
 		}
-		jsonData, err := json.MarshalIndent(user, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(user)
 	},
 }
 
 var getGroupsForUserCmd = &cobra.Command{
 	Use:   "groups",
 	Short: "Get groups for a user",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			log.Fatal("Needs user key as argument")
+			return errors.New("Needs user key as argument")
 		}
 		hiarcClient := ConfigureHiarcClient()
 
 		groups, r, err := hiarcClient.UserApi.GetGroupsForUser(context.Background(), args[0], nil)
 
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `UserApi.GetUser``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("UserApi.GetGroupsForUser", r, err)
 		}
-		jsonData, err := json.MarshalIndent(groups, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(groups)
 	},
 }
 
 var getGroupsForCurrentUserCmd = &cobra.Command{
 	Use:   "groups",
 	Short: "Get groups for current user",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		hiarcClient := ConfigureHiarcClient()
 		asUser, err := rootCmd.Flags().GetString("as-user")
 		opts := hiarc.GetGroupsForCurrentUserOpts{}
@@ -237,11 +221,9 @@ var getGroupsForCurrentUserCmd = &cobra.Command{
 		groups, r, err := hiarcClient.UserApi.GetGroupsForCurrentUser(context.Background(), &opts)
 
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error when calling `UserApi.GetUser``: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+			return NewAPIError("UserApi.GetGroupsForCurrentUser", r, err)
 		}
-		jsonData, err := json.MarshalIndent(groups, "", "    ")
-		fmt.Println(string(jsonData))
+		return PrintResult(groups)
 	},
 }
 
@@ -251,6 +233,7 @@ func init() {
 	userCmd.AddCommand(getUserCmd)
 	userCmd.AddCommand(updateUserCmd)
 	userCmd.AddCommand(deleteUserCmd)
+	addConfirmFlag(deleteUserCmd)
 	userCmd.AddCommand(findUserCmd)
 	getUserCmd.AddCommand(getAllUsersCmd)
 	getUserCmd.AddCommand(getCurrentUserCmd)
@@ -266,5 +249,7 @@ func init() {
 	updateUserCmd.Flags().StringVar(&userMetadata, "metadata", "", "User metadata")
 
 	findUserCmd.Flags().StringArrayVar(&userQueries, "query", make([]string, 0), "User query")
-	findUserCmd.MarkFlagRequired("query")
+	findUserCmd.Flags().StringVar(&whereFlag, "where", "", whereUse)
+	addListFlags(getAllUsersCmd)
+	addListFlags(findUserCmd)
 }
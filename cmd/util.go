@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 
 	hiarc "github.com/hiarcdb/hiarc-go-sdk"
 	"github.com/spf13/viper"
@@ -35,7 +37,19 @@ func GetConfigValuesByProfile(profile string) (string, string) {
 	return viper.GetString(fmt.Sprintf("%s.url", profile)), viper.GetString(fmt.Sprintf("%s.adminKey", profile))
 }
 
-func ConfigureHiarcClient() *hiarc.APIClient {
+// ProfileNames lists the profiles in the config, sorted.
+func ProfileNames() []string {
+	var names []string
+	for p := range viper.AllSettings() {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ActiveProfile returns the profile selected with --profile, falling back to
+// the HIARC_PROFILE environment variable when the flag isn't set.
+func ActiveProfile() string {
 	profile, _ := rootCmd.Flags().GetString("profile")
 	if profile == "default" {
 		k := os.Getenv(HiarcProfileEnvVar)
@@ -43,19 +57,33 @@ func ConfigureHiarcClient() *hiarc.APIClient {
 			profile = k
 		}
 	}
-	url, admin := GetConfigValuesByProfile(profile)
+	return profile
+}
+
+// clients caches the clients made by ConfigureHiarcClient, so a shell
+// session keeps using the same client for a profile.
+var clients = map[string]*hiarc.APIClient{}
+
+func ConfigureHiarcClient() *hiarc.APIClient {
+	url, admin := GetConfigValuesByProfile(ActiveProfile())
 	token, _ := rootCmd.Flags().GetString("token")
+	cacheKey := strings.Join([]string{url, admin, token}, "\n")
+	if c, ok := clients[cacheKey]; ok {
+		return c
+	}
+	c := ConfigureHiarcClientWithValues(url, admin)
 	if token != "" {
-		return ConfigureHiarcClientWithToken(url, token)
+		c = ConfigureHiarcClientWithToken(url, token)
 	}
-	return ConfigureHiarcClientWithValues(url, admin)
+	clients[cacheKey] = c
+	return c
 }
 
 func ConvertMetadataStringToObject(md string) (map[string]interface{}, error) {
 	var mdo map[string]interface{}
 	err := json.Unmarshal([]byte(md), &mdo)
 	if err != nil {
-		return nil, err
+		return nil, NewValidationError("Invalid metadata %s: %v", md, err)
 	}
 	return mdo, nil
 }
@@ -63,13 +91,16 @@ func ConvertQueryToObject(q string) (map[string]interface{}, error) {
 	var qo map[string]interface{}
 	err := json.Unmarshal([]byte(q), &qo)
 	if err != nil {
-		return nil, err
+		return nil, NewValidationError("Invalid query %s: %v", q, err)
 	}
 	return qo, nil
 }
+
+// AccessLevels lists the access levels Hiarc accepts.
+var AccessLevels = []string{string(hiarc.CO_OWNER), string(hiarc.READ_WRITE), string(hiarc.READ_ONLY), string(hiarc.UPLOAD_ONLY)}
+
 func IsValidAccessLevel(a string) bool {
-	levels := []string{string(hiarc.CO_OWNER), string(hiarc.READ_WRITE), string(hiarc.READ_ONLY), string(hiarc.UPLOAD_ONLY)}
-	for _, item := range levels {
+	for _, item := range AccessLevels {
 		if item == a {
 			return true
 		}
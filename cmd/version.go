@@ -10,8 +10,9 @@ var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print the version number of Hiarc CLI",
 	Long:  `All software has versions. This is Hiarc's`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		log.Println("Hiarc CLI v0.1.0")
+		return nil
 	},
 }
 
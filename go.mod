@@ -3,9 +3,12 @@ module github.com/hiarcdb/hiarc-cli
 go 1.13
 
 require (
-	github.com/hiarcdb/hiarc-go-sdk v0.0.1
 	github.com/antihax/optional v1.0.0
+	github.com/hiarcdb/hiarc-go-sdk v0.0.1
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/spf13/cobra v1.0.0
+	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.7.1
+	golang.org/x/sys v0.0.0-20200930185726-fdedc70b468f
+	gopkg.in/yaml.v2 v2.2.4
 )